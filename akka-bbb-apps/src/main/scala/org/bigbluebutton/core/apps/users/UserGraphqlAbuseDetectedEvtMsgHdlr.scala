@@ -0,0 +1,40 @@
+package org.bigbluebutton.core.apps.users
+
+import org.bigbluebutton.common2.msgs._
+import org.bigbluebutton.core.db.NotificationDAO
+import org.bigbluebutton.core.models.{ Roles, Users2x }
+import org.bigbluebutton.core.running.{ LiveMeeting, OutMsgRouter }
+import org.bigbluebutton.core2.message.senders.MsgBuilder
+
+trait UserGraphqlAbuseDetectedEvtMsgHdlr {
+  this: UsersApp =>
+
+  val liveMeeting: LiveMeeting
+  val outGW: OutMsgRouter
+
+  def handleUserGraphqlAbuseDetectedEvtMsg(msg: UserGraphqlAbuseDetectedEvtMsg): Unit = {
+    log.warning(
+      "User disconnected by graphql-middleware for abuse. meetingId={} userId={} score={} violations={}",
+      liveMeeting.props.meetingProp.intId,
+      msg.body.userId,
+      msg.body.score,
+      msg.body.violations
+    )
+
+    for {
+      user <- Users2x.findWithIntId(liveMeeting.users2x, msg.body.userId)
+    } yield {
+      val notifyEvent = MsgBuilder.buildNotifyRoleInMeetingEvtMsg(
+        Roles.MODERATOR_ROLE,
+        liveMeeting.props.meetingProp.intId,
+        "error",
+        "user",
+        "app.userList.graphqlAbuseDetected",
+        "Notification that a user was disconnected for sending too many invalid requests",
+        Map("0" -> s"${user.name}")
+      )
+      outGW.send(notifyEvent)
+      NotificationDAO.insert(notifyEvent)
+    }
+  }
+}
@@ -516,6 +516,13 @@ class ReceivedJsonMsgHandlerActor(
       case CheckGraphqlMiddlewareAlivePongSysMsg.NAME =>
         route[CheckGraphqlMiddlewareAlivePongSysMsg](meetingManagerChannel, envelope, jsonNode)
 
+      case UserGraphqlAbuseDetectedEvtMsg.NAME =>
+        for {
+          m <- deserialize[UserGraphqlAbuseDetectedEvtMsg](jsonNode)
+        } yield {
+          send(m.body.meetingId, envelope, m)
+        }
+
       case _ =>
         log.debug("Cannot route envelope name " + envelope.name)
       // do nothing
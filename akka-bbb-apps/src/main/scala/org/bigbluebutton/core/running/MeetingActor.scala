@@ -483,6 +483,9 @@ class MeetingActor(
       case m: GenerateLiveKitTokenRespMsg  => handleGenerateLiveKitTokenRespMsg(m)
       case m: LiveKitParticipantLeftEvtMsg => handleLiveKitParticipantLeftEvtMsg(m)
 
+      // Graphql middleware disconnected the user for abusing the API
+      case m: UserGraphqlAbuseDetectedEvtMsg => usersApp.handleUserGraphqlAbuseDetectedEvtMsg(m)
+
       // Client requested to eject user
       case m: EjectUserFromMeetingCmdMsg =>
         usersApp.handleEjectUserFromMeetingCmdMsg(m, state)
@@ -215,6 +215,13 @@ case class UserGraphqlDisconnectionForcedEvtMsg(
 ) extends BbbCoreMsg
 case class UserGraphqlDisconnectionForcedEvtMsgBody(middlewareUID: String, sessionToken: String, browserConnectionId: String)
 
+object UserGraphqlAbuseDetectedEvtMsg { val NAME = "UserGraphqlAbuseDetectedEvtMsg" }
+case class UserGraphqlAbuseDetectedEvtMsg(
+    header: BbbCoreBaseHeader,
+    body:   UserGraphqlAbuseDetectedEvtMsgBody
+) extends BbbCoreMsg
+case class UserGraphqlAbuseDetectedEvtMsgBody(middlewareUID: String, meetingId: String, userId: String, browserConnectionId: String, score: Double, violations: Map[String, Int])
+
 object UserGraphqlConnectionEstablishedSysMsg { val NAME = "UserGraphqlConnectionEstablishedSysMsg" }
 case class UserGraphqlConnectionEstablishedSysMsg(
     header: BbbCoreBaseHeader,
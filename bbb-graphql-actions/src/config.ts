@@ -4,4 +4,7 @@ export const REDIS_PORT = Number(process.env.BBB_REDIS_PORT) || 6379;
 export const SERVER_HOST = process.env.SERVER_HOST || '127.0.0.1';
 export const SERVER_PORT = Number(process.env.SERVER_PORT) || 8093;
 export const MAX_BODY_SIZE = Number(process.env.MAX_BODY_SIZE) || 10485760; // 10MB
+// Must be longer than outbox_max_wait_seconds plus mutation_timeout_seconds of bbb-graphql-middleware (60 + 30 by default),
+// so an action replayed from its outbox is still recognized
+export const IDEMPOTENCY_KEY_TTL_SECONDS = Number(process.env.IDEMPOTENCY_KEY_TTL_SECONDS) || 120;
 export const DEBUG = false;
@@ -1,7 +1,7 @@
 import express, { Request, Response } from 'express';
 import util from 'util';
 import { redisMessageFactory } from './imports/redisMessageFactory';
-import { DEBUG, SERVER_HOST, SERVER_PORT, MAX_BODY_SIZE } from './config';
+import { DEBUG, SERVER_HOST, SERVER_PORT, MAX_BODY_SIZE, IDEMPOTENCY_KEY_TTL_SECONDS } from './config';
 import { createRedisClient } from './imports/redis';
 import { ValidationError } from './types/ValidationError';
 
@@ -12,67 +12,145 @@ app.use(express.json({ limit: MAX_BODY_SIZE }));
 // Create and configure Redis client
 const redisClient = createRedisClient();
 
+// Idempotency keys of the actions already published (bbb-graphql-middleware sends the same key when it retries an action).
+const publishedIdempotencyKeys = new Map<string, number>();
+setInterval(() => {
+  const expiredBefore = Date.now() - IDEMPOTENCY_KEY_TTL_SECONDS * 1000;
+  publishedIdempotencyKeys.forEach((publishedAt, key) => {
+    if (publishedAt < expiredBefore) {
+      publishedIdempotencyKeys.delete(key);
+    }
+  });
+}, 60000);
+
 /**
- * Handles action submissions and publishes them to Redis.
+ * Handles an action, ignoring the ones with an idempotency key already published.
  */
-app.post('/', async (req: Request, res: Response) => {
-  try {
-    // Destructure relevant information from the request body.
-    const { action: { name: actionName }, input, session_variables: sessionVariables } = req.body;
-
+const handleAction = async (actionBody: any, idempotencyKey?: string) => {
+  // Destructure relevant information from the request body.
+  const { action: { name: actionName }, input, session_variables: sessionVariables } = actionBody;
 
+  if (idempotencyKey && publishedIdempotencyKeys.has(idempotencyKey)) {
     if(DEBUG) {
-      console.debug('-------------------------------------------');
-      console.debug(actionName);
-      console.debug(sessionVariables);
+      console.debug(`${actionName} with idempotency key ${idempotencyKey} was already published, ignoring it`);
     }
+    return true;
+  }
 
-    // Build message using received information.
-    const {
-      eventName,
-      routing,
-      header,
-      body
-    } = await redisMessageFactory.buildMessage(sessionVariables, actionName, input);
-
-    // Construct payload to be sent to Redis.
-    const redisPayload = {
-      envelope: {
-        name: eventName,
-        routing,
-        timestamp: Date.now(),
-      },
-      core: { header, body },
-    };
-
-    // If in debug mode, log the input and output information.
-    if(DEBUG) {
-      console.log(util.inspect({
-        input: { actionName, input, sessionVariables },
-        output: { redisPayload },
-      }, { depth: null, colors: true }));
-    }
+  // Reserved before publishing, so a retry received meanwhile is not published twice.
+  // The reservation is released when the action fails, so it can be retried.
+  if (idempotencyKey) {
+    publishedIdempotencyKeys.set(idempotencyKey, Date.now());
+  }
 
-    // Publish the constructed payload to Redis.
-    if(actionName == 'userThirdPartyInfoResquest') {
-      await redisClient.publish('to-third-party-redis-channel', JSON.stringify(redisPayload));
-    } else {
-      await redisClient.publish('to-akka-apps-redis-channel', JSON.stringify(redisPayload));
+  try {
+    await publishAction(actionName, input, sessionVariables);
+  } catch (error) {
+    if (idempotencyKey) {
+      publishedIdempotencyKeys.delete(idempotencyKey);
     }
+    throw error;
+  }
 
-    // Send a success response.
-    res.status(200).json(true);
+  return true;
+}
+
+/**
+ * Builds the message of an action and publishes it to Redis.
+ */
+const publishAction = async (actionName: string, input: any, sessionVariables: any) => {
+  if(DEBUG) {
+    console.debug('-------------------------------------------');
+    console.debug(actionName);
+    console.debug(sessionVariables);
+  }
+
+  // Build message using received information.
+  const {
+    eventName,
+    routing,
+    header,
+    body
+  } = await redisMessageFactory.buildMessage(sessionVariables, actionName, input);
+
+  // Construct payload to be sent to Redis.
+  const redisPayload = {
+    envelope: {
+      name: eventName,
+      routing,
+      timestamp: Date.now(),
+    },
+    core: { header, body },
+  };
+
+  // If in debug mode, log the input and output information.
+  if(DEBUG) {
+    console.log(util.inspect({
+      input: { actionName, input, sessionVariables },
+      output: { redisPayload },
+    }, { depth: null, colors: true }));
+  }
 
+  // Publish the constructed payload to Redis.
+  if(actionName == 'userThirdPartyInfoResquest') {
+    await redisClient.publish('to-third-party-redis-channel', JSON.stringify(redisPayload));
+  } else {
+    await redisClient.publish('to-akka-apps-redis-channel', JSON.stringify(redisPayload));
+  }
+}
+
+/**
+ * Converts the error of an action into its status and message.
+ */
+const buildActionError = (actionBody: any, error: unknown) => {
+  const actionName = actionBody?.action?.name || 'Unidentified Action';
+
+  if (error instanceof ValidationError) {
+    return { status: error.status, message: `${actionName}: ${error.message}` };
+  }
+
+  console.error(error);
+  return { status: 400, message: `${actionName}: Internal Server Error` };
+}
+
+/**
+ * Handles action submissions and publishes them to Redis.
+ */
+app.post('/', async (req: Request, res: Response) => {
+  try {
+    const result = await handleAction(req.body, req.get('Idempotency-Key'));
+
+    // Send a success response.
+    res.status(200).json(result);
   } catch (error) {
-    const actionName = req.body?.action?.name || 'Unidentified Action';
+    const { status, message } = buildActionError(req.body, error);
+    res.status(status).send({ message });
+  }
+});
+
+/**
+ * Handles batches of actions (sent by bbb-graphql-middleware for high-frequency actions).
+ * The actions are published one after the other and the response has one result per action, in the same order:
+ * `{ data }` on success or `{ error: { status, message } }`.
+ */
+app.post('/batch', async (req: Request, res: Response) => {
+  const batch = req.body?.batch;
+  if (!Array.isArray(batch)) {
+    res.status(400).send({ message: 'batch: an array of actions is expected' });
+    return;
+  }
 
-    if (error instanceof ValidationError) {
-      res.status(error.status).send({message: `${actionName}: ${error.message}`});
-    } else {
-      console.error(error);
-      res.status(400).send({message: `${actionName}: Internal Server Error`});
+  const results = [];
+  for (const actionBody of batch) {
+    try {
+      const data = await handleAction(actionBody, actionBody?.idempotency_key);
+      results.push({ data });
+    } catch (error) {
+      results.push({ error: buildActionError(actionBody, error) });
     }
   }
+
+  res.status(200).json(results);
 });
 
 // Start the server and establish a connection to Redis.
@@ -23,22 +23,54 @@ var (
 
 type Config struct {
 	Server struct {
-		Host                                 string `yaml:"listen_host"`
-		Port                                 int    `yaml:"listen_port"`
-		MaxConnections                       int    `yaml:"max_connections"`
-		MaxConnectionsPerSecond              int    `yaml:"max_connections_per_second"`
-		MaxConnectionsPerSessionToken        int    `yaml:"max_connections_per_session_token"`
-		MaxConnectionQueriesPerMinute        int    `yaml:"max_connection_queries_per_minute"`
-		MaxConnectionMutationsPerMinute      int    `yaml:"max_connection_mutations_per_minute"`
-		MaxConnectionConcurrentSubscriptions int    `yaml:"max_connection_concurrent_subscriptions"`
-		MaxQueryLength                       int    `yaml:"max_query_length"`
-		MaxQueryDepth                        int    `yaml:"max_query_depth"`
-		MaxMutationLength                    int    `yaml:"max_mutation_length"`
-		AuthorizedCrossOrigin                string `yaml:"authorized_cross_origin"`
-		JsonPatchDisabled                    bool   `yaml:"json_patch_disabled"`
-		SubscriptionAllowedList              string `yaml:"subscriptions_allowed_list"`
-		SubscriptionsDeniedList              string `yaml:"subscriptions_denied_list"`
-		WebsocketIdleTimeoutSeconds          int    `yaml:"websocket_idle_timeout_seconds"`
+		Host                                 string                       `yaml:"listen_host"`
+		Port                                 int                          `yaml:"listen_port"`
+		MaxConnections                       int                          `yaml:"max_connections"`
+		MaxConnectionsPerSecond              int                          `yaml:"max_connections_per_second"`
+		MaxConnectionsPerSessionToken        int                          `yaml:"max_connections_per_session_token"`
+		MaxConnectionQueriesPerMinute        int                          `yaml:"max_connection_queries_per_minute"`
+		MaxConnectionMutationsPerMinute      int                          `yaml:"max_connection_mutations_per_minute"`
+		MaxConnectionConcurrentMutations     int                          `yaml:"max_connection_concurrent_mutations"`
+		MutationOrderingKeys                 map[string]string            `yaml:"mutation_ordering_keys"`
+		MutationRateLimits                   map[string]MutationRateLimit `yaml:"mutation_rate_limits"`
+		MaxConnectionConcurrentSubscriptions int                          `yaml:"max_connection_concurrent_subscriptions"`
+		MaxQueryLength                       int                          `yaml:"max_query_length"`
+		MaxQueryDepth                        int                          `yaml:"max_query_depth"`
+		MaxMutationLength                    int                          `yaml:"max_mutation_length"`
+		AuthorizedCrossOrigin                string                       `yaml:"authorized_cross_origin"`
+		JsonPatchDisabled                    bool                         `yaml:"json_patch_disabled"`
+		SubscriptionAllowedList              string                       `yaml:"subscriptions_allowed_list"`
+		SubscriptionsDeniedList              string                       `yaml:"subscriptions_denied_list"`
+		WebsocketIdleTimeoutSeconds          int                          `yaml:"websocket_idle_timeout_seconds"`
+		QueryTimeoutSeconds                  int                          `yaml:"query_timeout_seconds"`
+		MutationTimeoutSeconds               int                          `yaml:"mutation_timeout_seconds"`
+		OperationTimeoutsSeconds             map[string]int               `yaml:"operation_timeouts_seconds"`
+		SubscriptionCacheEnabled             bool                         `yaml:"subscription_cache_enabled"`
+		SubscriptionCacheTtlSeconds          int                          `yaml:"subscription_cache_ttl_seconds"`
+		SubscriptionCacheSessionVariables    string                       `yaml:"subscription_cache_session_variables"`
+		SubscriptionCacheOperationsVariables map[string]string            `yaml:"subscription_cache_operations_session_variables"`
+		WebsocketCompressionMode             string                       `yaml:"websocket_compression_mode"`
+		WebsocketCompressionThreshold        int                          `yaml:"websocket_compression_threshold"`
+		PersistedQueriesManifestPath         string                       `yaml:"persisted_queries_manifest_path"`
+		PersistedQueriesStrict               bool                         `yaml:"persisted_queries_strict"`
+		MaxQueryCost                         int                          `yaml:"max_query_cost"`
+		MaxConnectionQueryCostPerMinute      int                          `yaml:"max_connection_query_cost_per_minute"`
+		QueryCostDefaultListSize             int                          `yaml:"query_cost_default_list_size"`
+		QueryCostFieldWeights                map[string]int               `yaml:"query_cost_field_weights"`
+		SchemaValidationEnabled              bool                         `yaml:"schema_validation_enabled"`
+		SchemaValidationRoles                string                       `yaml:"schema_validation_roles"`
+		OperationPolicyFilePath              string                       `yaml:"operation_policy_file_path"`
+		IntrospectionEnabled                 bool                         `yaml:"introspection_enabled"`
+		IntrospectionAllowedRoles            string                       `yaml:"introspection_allowed_roles"`
+		MaxVariablesSize                     int                          `yaml:"max_variables_size"`
+		MaxVariablesDepth                    int                          `yaml:"max_variables_depth"`
+		MaxVariablesArrayLength              int                          `yaml:"max_variables_array_length"`
+		AbuseScoreThreshold                  int                          `yaml:"abuse_score_threshold"`
+		AbuseScoreDecayPerSecond             float64                      `yaml:"abuse_score_decay_per_second"`
+		AbuseScoreWeights                    map[string]int               `yaml:"abuse_score_weights"`
+		SessionTokenLogRedaction             string                       `yaml:"session_token_log_redaction"`
+		SessionTokenHashKey                  string                       `yaml:"session_token_hash_key"`
+		RootFieldVariablesLimits             map[string]VariablesLimits   `yaml:"root_field_variables_limits"`
 	} `yaml:"server"`
 	Redis struct {
 		Host     string `yaml:"host"`
@@ -46,11 +78,42 @@ type Config struct {
 		Password string `yaml:"password"`
 	} `yaml:"redis"`
 	Hasura struct {
-		Url string `yaml:"url"`
+		Url                           string `yaml:"url"`
+		WebsocketCompressionMode      string `yaml:"websocket_compression_mode"`
+		WebsocketCompressionThreshold int    `yaml:"websocket_compression_threshold"`
+		Upstream                      string `yaml:"upstream"`
+		FakeEngineScriptPath          string `yaml:"fake_engine_script_path"`
+		AdminSecret                   string `yaml:"admin_secret"`
 	} `yaml:"hasura"`
 	GraphqlActions struct {
-		Url string `yaml:"url"`
+		Url                          string                    `yaml:"url"`
+		MaxIdleConnections           int                       `yaml:"max_idle_connections"`
+		MaxConnections               int                       `yaml:"max_connections"`
+		IdleConnectionTimeoutSeconds int                       `yaml:"idle_connection_timeout_seconds"`
+		RequestTimeoutSeconds        int                       `yaml:"request_timeout_seconds"`
+		BatchUrl                     string                    `yaml:"batch_url"`
+		BatchedActions               map[string]ActionBatching `yaml:"batched_actions"`
+		RetryableActions             string                    `yaml:"retryable_actions"`
+		RetryMaxAttempts             int                       `yaml:"retry_max_attempts"`
+		RetryInitialBackoffMs        int                       `yaml:"retry_initial_backoff_ms"`
+		RetryMaxBackoffMs            int                       `yaml:"retry_max_backoff_ms"`
+		CircuitBreakerFailures       int                       `yaml:"circuit_breaker_failures"`
+		CircuitBreakerOpenSeconds    int                       `yaml:"circuit_breaker_open_seconds"`
+		OutboxActions                string                    `yaml:"outbox_actions"`
+		OutboxMaxPerConnection       int                       `yaml:"outbox_max_per_connection"`
+		OutboxMaxTotal               int                       `yaml:"outbox_max_total"`
+		OutboxMaxWaitSeconds         int                       `yaml:"outbox_max_wait_seconds"`
 	} `yaml:"graphql-actions"`
+	Audit struct {
+		Sink                 string            `yaml:"sink"`
+		FilePath             string            `yaml:"file_path"`
+		FileMaxSizeMb        int               `yaml:"file_max_size_mb"`
+		FileMaxBackups       int               `yaml:"file_max_backups"`
+		RedisStream          string            `yaml:"redis_stream"`
+		RedisStreamMaxLength int64             `yaml:"redis_stream_max_length"`
+		RedactedInputs       map[string]string `yaml:"redacted_inputs"`
+		IgnoredActions       string            `yaml:"ignored_actions"`
+	} `yaml:"audit"`
 	AuthHook struct {
 		Url string `yaml:"url"`
 	} `yaml:"auth_hook"`
@@ -61,6 +124,24 @@ type Config struct {
 	PrometheusAdvancedMetricsEnabled bool   `yaml:"prometheus_advanced_metrics_enabled"`
 }
 
+type VariablesLimits struct {
+	MaxSize        int `yaml:"max_size"`
+	MaxDepth       int `yaml:"max_depth"`
+	MaxArrayLength int `yaml:"max_array_length"`
+}
+
+type MutationRateLimit struct {
+	Actions   string `yaml:"actions"`
+	Burst     int    `yaml:"burst"`
+	PerMinute int    `yaml:"per_minute"`
+	Message   string `yaml:"message"`
+}
+
+type ActionBatching struct {
+	MaxSize   int `yaml:"max_size"`
+	MaxWaitMs int `yaml:"max_wait_ms"`
+}
+
 func GetConfig() *Config {
 	once.Do(func() {
 		instance = &Config{}
@@ -110,12 +191,3 @@ func loadConfigFile(path string) (Config, error) {
 
 	return config, nil
 }
-
-var AllowedSubscriptionsForNotInMeetingUsers = []string{
-	"getUserInfo",
-	"getMeetingEndData",
-	"PluginConfigurationQuery",
-	"getGuestLobbyInfo",
-	"userCurrentSubscription",
-	"Patched_userCurrentSubscription",
-}
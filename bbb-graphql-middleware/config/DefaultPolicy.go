@@ -0,0 +1,8 @@
+package config
+
+import _ "embed"
+
+// DefaultPolicy is used when server.operation_policy_file_path is not set
+//
+//go:embed policy.yml
+var DefaultPolicy []byte
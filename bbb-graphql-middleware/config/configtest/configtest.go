@@ -0,0 +1,17 @@
+// Package configtest makes the tests load config/config.yml from the repository, instead of the installed config.
+// It must be imported (blank) by the test files of every package that reads the config.
+// Packages are initialized sorted by import path, so this one runs before the ones in internal/.
+package configtest
+
+import (
+	"path/filepath"
+	"runtime"
+
+	"bbb-graphql-middleware/config"
+)
+
+func init() {
+	_, currentFile, _, _ := runtime.Caller(0)
+	config.DefaultConfigPath = filepath.Join(filepath.Dir(currentFile), "..", "config.yml")
+	config.OverrideConfigPath = ""
+}
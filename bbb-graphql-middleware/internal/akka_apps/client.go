@@ -2,7 +2,9 @@ package akka_apps
 
 import (
 	"bbb-graphql-middleware/config"
+	"bbb-graphql-middleware/internal/common"
 	"encoding/json"
+	"errors"
 	"fmt"
 	log "github.com/sirupsen/logrus"
 	"io/ioutil"
@@ -18,7 +20,7 @@ var internalErrorId = "internal_error"
 func AkkaAppsGetSessionVariablesFrom(browserConnectionId string, sessionToken string, clientSessionUUID string) (map[string]string, error, string) {
 	logger := log.WithField("_routine", "AkkaAppsClient").
 		WithField("browserConnectionId", browserConnectionId).
-		WithField("sessionToken", sessionToken).
+		WithField("sessionToken", common.RedactSessionToken(sessionToken)).
 		WithField("clientSessionUUID", clientSessionUUID)
 
 	logger.Debug("Starting AkkaAppsClient")
@@ -33,7 +35,7 @@ func AkkaAppsGetSessionVariablesFrom(browserConnectionId string, sessionToken st
 		return nil, internalError, internalErrorId
 	}
 
-	log.Trace("Get user session vars from: " + sessionVarsHookUrl + "?sessionToken=" + sessionToken)
+	log.Trace("Get user session vars from: " + sessionVarsHookUrl + "?sessionToken=" + common.RedactSessionToken(sessionToken))
 
 	// Create a new HTTP request to the session_vars hook URL.
 	req, err := http.NewRequest("GET", sessionVarsHookUrl, nil)
@@ -71,7 +73,7 @@ func AkkaAppsGetSessionVariablesFrom(browserConnectionId string, sessionToken st
 	}
 	if response != "authorized" {
 		logger.Errorf("not authorized: Response: %s, Message: %s, MessageId: %s", response, message, messageId)
-		return nil, fmt.Errorf(message), messageId
+		return nil, errors.New(message), messageId
 	}
 
 	// Normalize the response header keys.
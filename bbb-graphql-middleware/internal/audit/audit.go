@@ -0,0 +1,156 @@
+package audit
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"time"
+
+	"bbb-graphql-middleware/config"
+	"bbb-graphql-middleware/internal/common"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+// Audit of the actions executed by the users (who did what in the meeting), written from gql_actions
+// to an NDJSON file (rotated by size) or to a Redis stream. The inputs are redacted according to redacted_inputs.
+
+const redactedValue = "[REDACTED]"
+
+var (
+	sink           recordSink
+	records        = make(chan []byte, 10000)
+	redactedInputs = make(map[string][]string) // fields redacted of each action ("*" for all actions/fields)
+	ignoredActions = make(map[string]bool)
+)
+
+type Record struct {
+	Timestamp     time.Time              `json:"timestamp"`
+	MeetingId     string                 `json:"meetingId"`
+	UserId        string                 `json:"userId"`
+	Action        string                 `json:"action"`
+	OperationName string                 `json:"operationName"`
+	Input         map[string]interface{} `json:"input,omitempty"`
+	Outcome       string                 `json:"outcome"`
+	LatencyMs     int64                  `json:"latencyMs"`
+}
+
+type recordSink interface {
+	write(record []byte) error
+}
+
+func init() {
+	auditConfig := config.GetConfig().Audit
+
+	switch auditConfig.Sink {
+	case "", "disabled":
+		return
+	case "file":
+		sink = newFileSink(auditConfig.FilePath, auditConfig.FileMaxSizeMb, auditConfig.FileMaxBackups)
+	case "redis":
+		sink = newRedisSink(auditConfig.RedisStream, auditConfig.RedisStreamMaxLength)
+	default:
+		log.Fatalf("Invalid audit sink %s (disabled, file or redis)", auditConfig.Sink)
+	}
+
+	for actionName, fields := range auditConfig.RedactedInputs {
+		for _, field := range strings.Split(fields, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				redactedInputs[actionName] = append(redactedInputs[actionName], field)
+			}
+		}
+	}
+
+	for _, actionName := range strings.Split(auditConfig.IgnoredActions, ",") {
+		if actionName = strings.TrimSpace(actionName); actionName != "" {
+			ignoredActions[actionName] = true
+		}
+	}
+
+	log.Infof("Audit of actions enabled (sink: %s)", auditConfig.Sink)
+	go writeRecords()
+}
+
+func IsEnabled() bool {
+	return sink != nil
+}
+
+// RecordAction adds the action to the audit (it never blocks, records are dropped when the sink can't keep up)
+func RecordAction(sessionVariables map[string]string, operationName string, actionName string, input map[string]interface{}, outcome string, latency time.Duration) {
+	if sink == nil || ignoredActions[actionName] {
+		return
+	}
+
+	record := Record{
+		Timestamp:     time.Now().UTC(),
+		MeetingId:     sessionVariables["x-hasura-meetingid"],
+		UserId:        sessionVariables["x-hasura-userid"],
+		Action:        actionName,
+		OperationName: operationName,
+		Input:         redactInput(actionName, input),
+		Outcome:       outcome,
+		LatencyMs:     latency.Milliseconds(),
+	}
+
+	jsonRecord, err := json.Marshal(record)
+	if err != nil {
+		log.Errorf("Error marshalling audit record of %s: %v", actionName, err)
+		common.GqlAuditRecordsCounter.With(prometheus.Labels{"result": "failed"}).Inc()
+		return
+	}
+
+	select {
+	case records <- jsonRecord:
+	default:
+		common.GqlAuditRecordsCounter.With(prometheus.Labels{"result": "dropped"}).Inc()
+	}
+}
+
+func writeRecords() {
+	for record := range records {
+		if err := sink.write(record); err != nil {
+			log.Errorf("Error writing audit record: %v", err)
+			common.GqlAuditRecordsCounter.With(prometheus.Labels{"result": "failed"}).Inc()
+			continue
+		}
+		common.GqlAuditRecordsCounter.With(prometheus.Labels{"result": "written"}).Inc()
+	}
+}
+
+// redactInput returns a copy of the input with the redacted fields (at any level) replaced
+func redactInput(actionName string, input map[string]interface{}) map[string]interface{} {
+	fields := slices.Concat(redactedInputs["*"], redactedInputs[actionName])
+	if slices.Contains(fields, "*") {
+		if len(input) == 0 {
+			return nil
+		}
+		return map[string]interface{}{"*": redactedValue}
+	}
+
+	redacted, _ := redactValue(input, fields).(map[string]interface{})
+	return redacted
+}
+
+func redactValue(value interface{}, fields []string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			if slices.Contains(fields, key) {
+				redacted[key] = redactedValue
+			} else {
+				redacted[key] = redactValue(item, fields)
+			}
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, item := range v {
+			redacted[i] = redactValue(item, fields)
+		}
+		return redacted
+	default:
+		return v
+	}
+}
@@ -0,0 +1,94 @@
+package audit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// fileSink appends the records (one json per line) to a file, rotated when it reaches the max size:
+// audit.ndjson -> audit.ndjson.1 -> audit.ndjson.2 ... (the oldest one beyond max backups is removed)
+type fileSink struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+func newFileSink(path string, maxSizeMb int, maxBackups int) *fileSink {
+	s := &fileSink{
+		path:       filepath.Clean(path),
+		maxSize:    int64(maxSizeMb) * 1024 * 1024,
+		maxBackups: maxBackups,
+	}
+
+	if err := s.open(); err != nil {
+		log.Fatalf("Error opening audit file %s: %v", s.path, err)
+	}
+
+	return s
+}
+
+func (s *fileSink) open() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0750); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	s.file = file
+	s.size = info.Size()
+	return nil
+}
+
+func (s *fileSink) write(record []byte) error {
+	if s.file == nil {
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+
+	if s.maxSize > 0 && s.size > 0 && s.size+int64(len(record))+1 > s.maxSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.file.Write(append(record, '\n'))
+	s.size += int64(n)
+	return err
+}
+
+func (s *fileSink) rotate() error {
+	s.file.Close()
+	s.file = nil
+
+	if s.maxBackups <= 0 {
+		if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	} else {
+		for i := s.maxBackups - 1; i > 0; i-- {
+			if err := os.Rename(fmt.Sprintf("%s.%d", s.path, i), fmt.Sprintf("%s.%d", s.path, i+1)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		if err := os.Rename(s.path, s.path+".1"); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return s.open()
+}
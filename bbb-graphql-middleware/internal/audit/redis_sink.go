@@ -0,0 +1,42 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"bbb-graphql-middleware/config"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisSink adds the records to a Redis stream (field `record` with the json), trimmed to an approximate max length
+type redisSink struct {
+	client    *redis.Client
+	stream    string
+	maxLength int64
+}
+
+func newRedisSink(stream string, maxLength int64) *redisSink {
+	return &redisSink{
+		client: redis.NewClient(&redis.Options{
+			Addr:     fmt.Sprintf("%s:%d", config.GetConfig().Redis.Host, config.GetConfig().Redis.Port),
+			Password: config.GetConfig().Redis.Password,
+			DB:       0,
+		}),
+		stream:    stream,
+		maxLength: maxLength,
+	}
+}
+
+func (s *redisSink) write(record []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return s.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: s.stream,
+		MaxLen: s.maxLength,
+		Approx: s.maxLength > 0,
+		Values: map[string]interface{}{"record": string(record)},
+	}).Err()
+}
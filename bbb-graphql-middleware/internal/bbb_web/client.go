@@ -2,6 +2,7 @@ package bbb_web
 
 import (
 	"bbb-graphql-middleware/config"
+	"bbb-graphql-middleware/internal/common"
 	"encoding/json"
 	"fmt"
 	log "github.com/sirupsen/logrus"
@@ -17,7 +18,7 @@ var authHookUrl = config.GetConfig().AuthHook.Url
 func BBBWebCheckAuthorization(browserConnectionId string, sessionToken string, clientSessionUUID string, cookies []*http.Cookie) (string, string, error) {
 	logger := log.WithField("_routine", "BBBWebClient").
 		WithField("browserConnectionId", browserConnectionId).
-		WithField("sessionToken", sessionToken).
+		WithField("sessionToken", common.RedactSessionToken(sessionToken)).
 		WithField("clientSessionUUID", clientSessionUUID)
 
 	logger.Debug("Starting BBBWebClient")
@@ -61,7 +62,7 @@ func BBBWebCheckAuthorization(browserConnectionId string, sessionToken string, c
 		return "", "", err
 	}
 
-	log.Trace(string(respBody))
+	log.Trace(common.RedactSessionTokensInJson(string(respBody)))
 
 	var respBodyAsMap map[string]string
 	if err := json.Unmarshal(respBody, &respBodyAsMap); err != nil {
@@ -91,7 +92,7 @@ func BBBWebCheckAuthorization(browserConnectionId string, sessionToken string, c
 
 	//Get userId and meetingId from response Header
 	for key, value := range normalizedResponse {
-		log.Debug("%s: %s\n", key, value)
+		log.Debugf("%s: %s\n", key, value)
 
 		if key == "x-userid" {
 			userId = value
@@ -0,0 +1,117 @@
+package common
+
+import (
+	"sync"
+	"time"
+
+	"bbb-graphql-middleware/config"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Abuse score of each session (sessionToken): every violation adds its weight and the score decays over time.
+// When the threshold is crossed, the handler registered by websrv disconnects the session and reports it to akka-apps
+
+type AbuseReason string
+
+const (
+	AbuseReasonRateLimited      AbuseReason = "rate_limited"
+	AbuseReasonRejectedQuery    AbuseReason = "rejected_query"
+	AbuseReasonMalformedMessage AbuseReason = "malformed_message"
+	AbuseReasonOversizedPayload AbuseReason = "oversized_payload"
+)
+
+var (
+	abuseScoreThreshold      = float64(config.GetConfig().Server.AbuseScoreThreshold)
+	abuseScoreDecayPerSecond = config.GetConfig().Server.AbuseScoreDecayPerSecond
+	abuseScoreWeights        = config.GetConfig().Server.AbuseScoreWeights
+)
+
+type abuseScore struct {
+	score      float64
+	updatedAt  time.Time
+	violations map[AbuseReason]int
+}
+
+var abuseScores = make(map[string]*abuseScore)
+var abuseScoresMutex sync.Mutex
+
+var abuseDetectedHandler func(browserConnection *BrowserConnection, score float64, violations map[AbuseReason]int)
+
+func init() {
+	if abuseScoreThreshold <= 0 {
+		return
+	}
+
+	// Remove the scores that already decayed
+	go func() {
+		for {
+			time.Sleep(1 * time.Minute)
+
+			abuseScoresMutex.Lock()
+			for sessionToken, sessionScore := range abuseScores {
+				if getDecayedScore(sessionScore) <= 0 {
+					delete(abuseScores, sessionToken)
+				}
+			}
+			abuseScoresMutex.Unlock()
+		}
+	}()
+}
+
+// SetAbuseDetectedHandler sets the function called when a session crosses the threshold
+func SetAbuseDetectedHandler(handler func(browserConnection *BrowserConnection, score float64, violations map[AbuseReason]int)) {
+	abuseDetectedHandler = handler
+}
+
+// AddAbuseScore registers a violation of the session of the connection
+func AddAbuseScore(browserConnection *BrowserConnection, reason AbuseReason) {
+	GqlAbuseViolationsCounter.With(prometheus.Labels{"reason": string(reason)}).Inc()
+
+	if abuseScoreThreshold <= 0 {
+		return
+	}
+
+	browserConnection.RLock()
+	sessionToken := browserConnection.SessionToken
+	browserConnection.RUnlock()
+	if sessionToken == "" {
+		return
+	}
+
+	weight := 1
+	if configuredWeight, exists := abuseScoreWeights[string(reason)]; exists {
+		weight = configuredWeight
+	}
+
+	abuseScoresMutex.Lock()
+	sessionScore, exists := abuseScores[sessionToken]
+	if !exists {
+		sessionScore = &abuseScore{violations: make(map[AbuseReason]int)}
+		abuseScores[sessionToken] = sessionScore
+	}
+	sessionScore.score = getDecayedScore(sessionScore) + float64(weight)
+	sessionScore.updatedAt = time.Now()
+	sessionScore.violations[reason]++
+
+	thresholdCrossed := sessionScore.score >= abuseScoreThreshold
+	score := sessionScore.score
+	violations := sessionScore.violations
+	if thresholdCrossed {
+		// Start again, the session is about to be disconnected
+		delete(abuseScores, sessionToken)
+	}
+	abuseScoresMutex.Unlock()
+
+	if thresholdCrossed {
+		browserConnection.Logger.Warnf("Abuse score %.1f reached the threshold %.1f (violations: %v)", score, abuseScoreThreshold, violations)
+		GqlAbuseDisconnectionsCounter.Inc()
+		if abuseDetectedHandler != nil {
+			go abuseDetectedHandler(browserConnection, score, violations)
+		}
+	}
+}
+
+func getDecayedScore(sessionScore *abuseScore) float64 {
+	return max(sessionScore.score-time.Since(sessionScore.updatedAt).Seconds()*abuseScoreDecayPerSecond, 0)
+}
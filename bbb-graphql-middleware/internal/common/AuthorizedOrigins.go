@@ -0,0 +1,107 @@
+package common
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+
+	"bbb-graphql-middleware/config"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+// Origins (besides the host of the server) authorized to connect, e.g. 'bbb-proxy.example.com,*.example.org'
+// Patterns use the same syntax of AcceptOptions.OriginPatterns (path.Match against the host of the origin,
+// or against the whole origin when the pattern has a scheme)
+
+var AuthorizedCrossOrigins = SplitConfigList(config.GetConfig().Server.AuthorizedCrossOrigin)
+
+// Distinct origins used as metric label, the next ones are counted as `other`
+const maxRejectedOriginsLabels = 50
+
+var rejectedOriginsLabels = make(map[string]bool)
+var rejectedOriginsLabelsMutex sync.Mutex
+
+// IsOriginAuthorized checks the Origin header of the request (requests without it don't come from browsers)
+func IsOriginAuthorized(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(r.Host, u.Host) {
+		return true
+	}
+
+	for _, pattern := range AuthorizedCrossOrigins {
+		target := u.Host
+		if strings.Contains(pattern, "://") {
+			target = origin
+		}
+		if matched, err := path.Match(strings.ToLower(pattern), strings.ToLower(target)); err == nil && matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CheckOrigin rejects (403) the requests of origins not authorized, logging and counting them
+// It returns false when the request was rejected
+func CheckOrigin(w http.ResponseWriter, r *http.Request, endpoint string) bool {
+	if IsOriginAuthorized(r) {
+		return true
+	}
+
+	origin := r.Header.Get("Origin")
+	log.WithField("_routine", "CheckOrigin").Warnf("Request to %s rejected, origin %s is not authorized", endpoint, origin)
+	HttpOriginRejectedCounter.With(prometheus.Labels{"endpoint": endpoint, "origin": getRejectedOriginLabel(origin)}).Inc()
+	http.Error(w, "request Origin is not authorized", http.StatusForbidden)
+
+	return false
+}
+
+// HandleCors checks the origin and sets the CORS headers of an HTTP endpoint, answering the preflight requests
+// It returns false when the request was already answered
+func HandleCors(w http.ResponseWriter, r *http.Request, endpoint string, allowedMethods string) bool {
+	if !CheckOrigin(w, r, endpoint) {
+		return false
+	}
+
+	if origin := r.Header.Get("Origin"); origin != "" {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+		w.Header().Add("Vary", "Origin")
+	}
+
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Access-Control-Allow-Methods", allowedMethods)
+		w.Header().Set("Access-Control-Allow-Headers", r.Header.Get("Access-Control-Request-Headers"))
+		w.WriteHeader(http.StatusNoContent)
+		return false
+	}
+
+	return true
+}
+
+func getRejectedOriginLabel(origin string) string {
+	rejectedOriginsLabelsMutex.Lock()
+	defer rejectedOriginsLabelsMutex.Unlock()
+
+	if rejectedOriginsLabels[origin] {
+		return origin
+	}
+	if len(rejectedOriginsLabels) < maxRejectedOriginsLabels {
+		rejectedOriginsLabels[origin] = true
+		return origin
+	}
+
+	return "other"
+}
@@ -0,0 +1,15 @@
+package common
+
+import "strings"
+
+// SplitConfigList returns the items of a comma separated list of the config (trimmed, without the empty ones)
+func SplitConfigList(list string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
@@ -0,0 +1,19 @@
+package common
+
+import (
+	"fmt"
+
+	"github.com/coder/websocket"
+)
+
+// CloseDuplicateSubscriber closes the connection when the browser reuses the id of an active operation
+// graphql-transport-ws requires `4409: Subscriber for <id> already exists`
+// https://github.com/enisdenjo/graphql-ws/blob/master/PROTOCOL.md#subscribe
+func CloseDuplicateSubscriber(browserConnection *BrowserConnection, queryId string) {
+	browserConnection.Logger.Warnf("Closing connection as the browser sent a subscribe with the id %s that is already active", queryId)
+
+	if err := browserConnection.Websocket.Close(websocket.StatusCode(4409), fmt.Sprintf("Subscriber for %s already exists", queryId)); err != nil {
+		browserConnection.Logger.Debugf("Error on close websocket: %v", err)
+	}
+	browserConnection.ContextCancelFunc()
+}
@@ -0,0 +1,120 @@
+package common
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Error codes sent to the browser as `messageId` in the payload of `error` messages.
+// Clients should rely on them (instead of the message text) to react programmatically.
+// Errors coming from Hasura and graphql-actions are translated into one of these codes,
+// their original details are kept only in the logs.
+const (
+	ErrorIdPermissionDenied    = "permission_denied"    // user is not allowed to execute the operation
+	ErrorIdRateLimited         = "rate_limited"         // too many operations in a short period
+	ErrorIdLimitExceeded       = "limit_exceeded"       // operation exceeds a configured limit (length, depth, concurrent subscriptions)
+	ErrorIdValidationFailed    = "validation_failed"    // operation is invalid (parse error, unknown field, wrong arguments)
+	ErrorIdUpstreamUnavailable = "upstream_unavailable" // Hasura or graphql-actions could not be reached
+	ErrorIdOperationTimeout    = "operation_timeout"    // no answer was received in time
+	ErrorIdInternalError       = "internal_error"       // unexpected failure
+	ErrorIdAbuseDetected       = "abuse_detected"       // session was disconnected after too many violations (close code 4429)
+	// hash sent by the browser is not in the persisted queries manifest (message is `PersistedQueryNotFound`, as expected by Apollo clients)
+	ErrorIdPersistedQueryNotFound = "persisted_query_not_found"
+)
+
+var errorMessages = map[string]string{
+	ErrorIdPermissionDenied:       "Permission denied",
+	ErrorIdRateLimited:            "Rate limit exceeded, please try again later",
+	ErrorIdLimitExceeded:          "Operation exceeds the allowed limits",
+	ErrorIdValidationFailed:       "Operation is not valid",
+	ErrorIdUpstreamUnavailable:    "Service temporarily unavailable, please try again later",
+	ErrorIdOperationTimeout:       "Operation timed out",
+	ErrorIdInternalError:          "Internal server error",
+	ErrorIdPersistedQueryNotFound: "PersistedQueryNotFound",
+	ErrorIdAbuseDetected:          "Too many invalid operations, the connection was closed",
+}
+
+// GetErrorMessage returns the generic message of an error code, to be used when the details can't be exposed
+func GetErrorMessage(errorId string) string {
+	if message, exists := errorMessages[errorId]; exists {
+		return message
+	}
+
+	return errorMessages[ErrorIdInternalError]
+}
+
+// GetErrorIdFromHasuraErrorCode translates the `extensions.code` of an error sent by Hasura
+func GetErrorIdFromHasuraErrorCode(hasuraErrorCode string) string {
+	switch hasuraErrorCode {
+	case "access-denied", "permission-denied", "permission-error",
+		"invalid-headers", "invalid-jwt", "jwt-invalid-claims", "jwt-missing-role-claims":
+		return ErrorIdPermissionDenied
+	case "validation-failed", "parse-failed", "bad-request", "not-supported", "invalid-params",
+		"not-found", "not-exists", "constraint-violation", "constraint-error", "data-exception":
+		return ErrorIdValidationFailed
+	case "rate-limited", "rate-limit-exceeded":
+		return ErrorIdRateLimited
+	case "postgres-max-connections-error", "connection-error":
+		return ErrorIdUpstreamUnavailable
+	case "timeout":
+		return ErrorIdOperationTimeout
+	default:
+		return ErrorIdInternalError
+	}
+}
+
+// GetErrorIdFromHttpStatus translates the HTTP status code of a response sent by graphql-actions
+func GetErrorIdFromHttpStatus(statusCode int) string {
+	switch statusCode {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity, http.StatusNotFound:
+		return ErrorIdValidationFailed
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrorIdPermissionDenied
+	case http.StatusTooManyRequests:
+		return ErrorIdRateLimited
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return ErrorIdUpstreamUnavailable
+	case http.StatusGatewayTimeout, http.StatusRequestTimeout:
+		return ErrorIdOperationTimeout
+	default:
+		return ErrorIdInternalError
+	}
+}
+
+// BuildErrorPayload returns the payload of an `error` message to be sent to the browser
+func BuildErrorPayload(errorId string, errorMessage string) []interface{} {
+	return []interface{}{
+		map[string]interface{}{
+			"message":   errorMessage,
+			"messageId": errorId,
+			"extensions": map[string]interface{}{
+				"code": errorId,
+			},
+		},
+	}
+}
+
+// SendErrorMessage logs the error and sends it to the browser (`error` followed by `complete`)
+func SendErrorMessage(browserConnection *BrowserConnection, messageId string, errorId string, errorMessage string) {
+	browserConnection.Logger.Error(errorMessage)
+
+	SendErrorPayload(browserConnection, messageId, BuildErrorPayload(errorId, errorMessage))
+}
+
+// SendErrorPayload sends an `error` message with the payload, followed by `complete`
+func SendErrorPayload(browserConnection *BrowserConnection, messageId string, payload []interface{}) {
+	browserResponseData := map[string]interface{}{
+		"id":      messageId,
+		"type":    "error",
+		"payload": payload,
+	}
+	jsonDataError, _ := json.Marshal(browserResponseData)
+	browserConnection.FromHasuraToBrowserChannel.SendWait(browserConnection.Context, jsonDataError)
+
+	browserResponseComplete := map[string]interface{}{
+		"id":   messageId,
+		"type": "complete",
+	}
+	jsonDataComplete, _ := json.Marshal(browserResponseComplete)
+	browserConnection.FromHasuraToBrowserChannel.SendWait(browserConnection.Context, jsonDataComplete)
+}
@@ -0,0 +1,29 @@
+package common
+
+import (
+	"slices"
+	"strings"
+
+	"bbb-graphql-middleware/config"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	introspectionEnabled      = config.GetConfig().Server.IntrospectionEnabled
+	introspectionAllowedRoles = splitSessionVariablesList(config.GetConfig().Server.IntrospectionAllowedRoles)
+)
+
+// IsIntrospectionAllowed checks if the role can query the schema (and counts the attempt)
+func IsIntrospectionAllowed(role string) bool {
+	allowed := introspectionEnabled &&
+		(len(introspectionAllowedRoles) == 0 || slices.Contains(introspectionAllowedRoles, strings.ToLower(role)))
+
+	result := "denied"
+	if allowed {
+		result = "allowed"
+	}
+	GqlIntrospectionCounter.With(prometheus.Labels{"role": role, "result": result}).Inc()
+
+	return allowed
+}
@@ -0,0 +1,119 @@
+package common
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"bbb-graphql-middleware/config"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+// Rate limits of specific actions (mutation_rate_limits), each rule has its own bucket in every connection.
+// Actions without a rule keep using the bucket of max_connection_mutations_per_minute.
+
+const DefaultMutationRateLimitRule = "default"
+
+var (
+	mutationRateLimitRules      = make(map[string]config.MutationRateLimit)
+	mutationRateLimitRuleByName = make(map[string]string) // rule of each action
+)
+
+func init() {
+	for ruleName, rule := range config.GetConfig().Server.MutationRateLimits {
+		if rule.PerMinute <= 0 {
+			log.Warnf("Mutation rate limit %s ignored: per_minute must be greater than 0", ruleName)
+			continue
+		}
+		if rule.Burst <= 0 {
+			rule.Burst = 1
+		}
+
+		mutationRateLimitRules[ruleName] = rule
+		for _, actionName := range strings.Split(rule.Actions, ",") {
+			actionName = strings.TrimSpace(actionName)
+			if actionName == "" {
+				continue
+			}
+			// The map has no order, so the first rule by name is kept
+			if otherRule, exists := mutationRateLimitRuleByName[actionName]; exists {
+				log.Warnf("Action %s is in the mutation rate limits %s and %s, only %s will be used", actionName, otherRule, ruleName, min(otherRule, ruleName))
+				mutationRateLimitRuleByName[actionName] = min(otherRule, ruleName)
+				continue
+			}
+			mutationRateLimitRuleByName[actionName] = ruleName
+		}
+	}
+}
+
+// NewMutationRateLimiters creates the buckets of the rules for a new connection
+func NewMutationRateLimiters() map[string]*rate.Limiter {
+	limiters := make(map[string]*rate.Limiter, len(mutationRateLimitRules))
+	for ruleName, rule := range mutationRateLimitRules {
+		limiters[ruleName] = rate.NewLimiter(rate.Limit(float64(rule.PerMinute)/60), rule.Burst)
+	}
+
+	return limiters
+}
+
+// GetMutationRateLimitRules returns how many actions use each rule
+// and how many have no rule (so they should use the default bucket)
+// Every action counts, so aliasing the same field many times in one mutation takes many tokens
+func GetMutationRateLimitRules(actionNames []string) (actionsByRule map[string]int, withoutRule int) {
+	actionsByRule = make(map[string]int)
+	for _, actionName := range actionNames {
+		ruleName, exists := mutationRateLimitRuleByName[actionName]
+		if !exists {
+			withoutRule++
+			continue
+		}
+		actionsByRule[ruleName]++
+	}
+
+	return actionsByRule, withoutRule
+}
+
+// AllowMutationRateLimits takes a token of each rule per action, and none of them when some rule is exceeded
+// It returns the rule exceeded (empty when allowed)
+func AllowMutationRateLimits(browserConnection *BrowserConnection, actionsByRule map[string]int) string {
+	rules := slices.Sorted(maps.Keys(actionsByRule))
+
+	now := time.Now()
+	reservations := make([]*rate.Reservation, 0, len(rules))
+	for _, ruleName := range rules {
+		limiter, exists := browserConnection.MutationRateLimiters[ruleName]
+		if !exists {
+			continue
+		}
+
+		reservation := limiter.ReserveN(now, actionsByRule[ruleName])
+		if !reservation.OK() || reservation.DelayFrom(now) > 0 {
+			reservation.CancelAt(now)
+			for _, previousReservation := range reservations {
+				previousReservation.CancelAt(now)
+			}
+			return ruleName
+		}
+		reservations = append(reservations, reservation)
+	}
+
+	return ""
+}
+
+// GetMutationRateLimitMessage returns the message sent to the browser when the rule is exceeded
+func GetMutationRateLimitMessage(ruleName string) string {
+	rule, exists := mutationRateLimitRules[ruleName]
+	if !exists {
+		return fmt.Sprintf("Rate limit exceeded: Maximum %d mutations per minute allowed. Please try again later.", config.GetConfig().Server.MaxConnectionMutationsPerMinute)
+	}
+
+	if rule.Message != "" {
+		return rule.Message
+	}
+
+	return fmt.Sprintf("Rate limit exceeded: Maximum %d mutations per minute allowed for %s. Please try again later.", rule.PerMinute, ruleName)
+}
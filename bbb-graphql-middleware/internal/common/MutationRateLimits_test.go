@@ -0,0 +1,101 @@
+package common
+
+import (
+	"maps"
+	"testing"
+
+	_ "bbb-graphql-middleware/config/configtest"
+)
+
+func TestGetMutationRateLimitRules(t *testing.T) {
+	tests := []struct {
+		name                string
+		actionNames         []string
+		expectedByRule      map[string]int
+		expectedWithoutRule int
+	}{
+		{
+			name:           "single action",
+			actionNames:    []string{"chatSendMessage"},
+			expectedByRule: map[string]int{"chat": 1},
+		},
+		{
+			name:           "aliases of the same action",
+			actionNames:    []string{"chatSendMessage", "chatSendMessage", "chatSendMessage"},
+			expectedByRule: map[string]int{"chat": 3},
+		},
+		{
+			name:                "actions of many rules and without rule",
+			actionNames:         []string{"chatSendMessage", "presAnnotationSubmit", "userSetAway", "chatEditMessage", "userSetAway"},
+			expectedByRule:      map[string]int{"chat": 2, "whiteboard": 1},
+			expectedWithoutRule: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actionsByRule, withoutRule := GetMutationRateLimitRules(tt.actionNames)
+			if !maps.Equal(actionsByRule, tt.expectedByRule) {
+				t.Errorf("expected %v by rule, got %v", tt.expectedByRule, actionsByRule)
+			}
+			if withoutRule != tt.expectedWithoutRule {
+				t.Errorf("expected %d without rule, got %d", tt.expectedWithoutRule, withoutRule)
+			}
+		})
+	}
+}
+
+func TestAllowMutationRateLimits(t *testing.T) {
+	// chat rule of the default config: burst 10
+	tests := []struct {
+		name           string
+		mutations      [][]string // actions of each mutation, sent in sequence
+		expectedDenied []string   // rule exceeded by each mutation
+	}{
+		{
+			name:           "within the burst",
+			mutations:      [][]string{{"chatSendMessage"}, {"chatSendMessage"}},
+			expectedDenied: []string{"", ""},
+		},
+		{
+			name:           "aliases can't bypass the burst",
+			mutations:      [][]string{repeatAction("chatSendMessage", 11)},
+			expectedDenied: []string{"chat"},
+		},
+		{
+			name:           "denied mutation takes no tokens",
+			mutations:      [][]string{repeatAction("chatSendMessage", 11), repeatAction("chatSendMessage", 10)},
+			expectedDenied: []string{"chat", ""},
+		},
+		{
+			name: "exceeding one rule takes no tokens of the others",
+			mutations: [][]string{
+				repeatAction("chatSendMessage", 8),
+				append(repeatAction("chatSendMessage", 3), repeatAction("presAnnotationSubmit", 600)...),
+				repeatAction("presAnnotationSubmit", 600),
+			},
+			expectedDenied: []string{"", "chat", ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			browserConnection := &BrowserConnection{MutationRateLimiters: NewMutationRateLimiters()}
+			for i, actionNames := range tt.mutations {
+				actionsByRule, _ := GetMutationRateLimitRules(actionNames)
+				if denied := AllowMutationRateLimits(browserConnection, actionsByRule); denied != tt.expectedDenied[i] {
+					t.Errorf("mutation %d: expected %q exceeded, got %q", i, tt.expectedDenied[i], denied)
+				}
+			}
+		})
+	}
+}
+
+func repeatAction(actionName string, times int) []string {
+	actionNames := make([]string, times)
+	for i := range actionNames {
+		actionNames[i] = actionName
+	}
+
+	return actionNames
+}
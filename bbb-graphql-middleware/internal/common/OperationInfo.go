@@ -0,0 +1,285 @@
+package common
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+)
+
+// OperationInfo is the result of parsing the query of a browser message
+// It's used to route and classify operations (instead of matching strings in the query)
+type OperationInfo struct {
+	Name                     string                   // name of the operation declared in the query
+	OperationType            string                   // query, mutation or subscription (as declared)
+	Type                     QueryType                // classification used by the middleware
+	RootFields               []string                 // names of the fields selected at the root of the operation
+	StreamCursorField        string                   // field used as cursor in the `_stream` root field
+	StreamCursorVariableName string                   // variable that holds the initial value of the cursor (when not inline)
+	StreamCursorInlineValue  string                   // initial value of the cursor when it's inline in the query
+	IsAggregate              bool                     // root field is an `_aggregate` selecting `aggregate`
+	IsIntrospection          bool                     // selects `__schema` or `__type` (introspection of the schema)
+	Document                 *ast.Document            // parsed query, it's shared so it must not be modified
+	Operation                *ast.OperationDefinition // operation selected from Document
+}
+
+// Parsed queries are cached for 5 minutes, up to a limit of entries (queries come from the browser)
+// When the cache is full, new queries are parsed without being cached until the expired ones are removed
+const (
+	operationInfoCacheTtl     = 5 * time.Minute
+	operationInfoCacheMaxSize = 10000
+)
+
+type operationInfoCacheEntry struct {
+	operationInfo *OperationInfo
+	storedAt      time.Time
+}
+
+var operationInfoCache = make(map[[32]byte]operationInfoCacheEntry)
+var operationInfoCacheMutex sync.RWMutex
+
+func init() {
+	go removeExpiredOperationInfoCache()
+}
+
+// GetOperationInfo parses the query (once per query hash) and classifies the operation
+// When the document contains more than one operation, the one named operationName is used
+func GetOperationInfo(query string, operationName string) (*OperationInfo, error) {
+	cacheKey := sha256.Sum256([]byte(operationName + "\n" + query))
+
+	operationInfoCacheMutex.RLock()
+	entry, exists := operationInfoCache[cacheKey]
+	operationInfoCacheMutex.RUnlock()
+	if exists {
+		return entry.operationInfo, nil
+	}
+
+	operationInfo, err := parseOperationInfo(query, operationName)
+	if err != nil {
+		return nil, err
+	}
+
+	operationInfoCacheMutex.Lock()
+	if len(operationInfoCache) < operationInfoCacheMaxSize {
+		operationInfoCache[cacheKey] = operationInfoCacheEntry{operationInfo: operationInfo, storedAt: time.Now()}
+	}
+	operationInfoCacheMutex.Unlock()
+
+	return operationInfo, nil
+}
+
+// removeExpiredOperationInfoCache removes the entries older than the TTL
+func removeExpiredOperationInfoCache() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		operationInfoCacheMutex.Lock()
+		for cacheKey, entry := range operationInfoCache {
+			if time.Since(entry.storedAt) > operationInfoCacheTtl {
+				delete(operationInfoCache, cacheKey)
+			}
+		}
+		operationInfoCacheMutex.Unlock()
+	}
+}
+
+func ParseQuery(query string) (*ast.Document, error) {
+	return parser.Parse(parser.ParseParams{
+		Source: source.NewSource(&source.Source{
+			Body: []byte(query),
+			Name: "GraphQL query",
+		}),
+	})
+}
+
+// GetOperationDefinition returns the operation named operationName (or the first one when it's not found)
+func GetOperationDefinition(astDoc *ast.Document, operationName string) *ast.OperationDefinition {
+	var firstOperation *ast.OperationDefinition
+	for _, def := range astDoc.Definitions {
+		if op, ok := def.(*ast.OperationDefinition); ok {
+			if firstOperation == nil {
+				firstOperation = op
+			}
+			if operationName != "" && op.Name != nil && op.Name.Value == operationName {
+				return op
+			}
+		}
+	}
+
+	return firstOperation
+}
+
+func parseOperationInfo(query string, operationName string) (*OperationInfo, error) {
+	astDoc, err := ParseQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse query: %v", err)
+	}
+
+	op := GetOperationDefinition(astDoc, operationName)
+	if op == nil {
+		return nil, fmt.Errorf("no operation found in the query")
+	}
+
+	operationInfo := &OperationInfo{
+		OperationType: op.Operation,
+		Document:      astDoc,
+		Operation:     op,
+	}
+	if op.Name != nil {
+		operationInfo.Name = op.Name.Value
+	}
+
+	for _, rootField := range getRootFields(op.SelectionSet) {
+		operationInfo.RootFields = append(operationInfo.RootFields, rootField.Name.Value)
+
+		if strings.HasSuffix(rootField.Name.Value, "_stream") && operationInfo.StreamCursorField == "" {
+			setStreamCursorProps(operationInfo, rootField)
+		}
+
+		if strings.HasSuffix(rootField.Name.Value, "_aggregate") && hasChildField(rootField, "aggregate") {
+			operationInfo.IsAggregate = true
+		}
+	}
+
+	operationInfo.IsIntrospection = hasIntrospectionField(op.SelectionSet, GetFragmentDefinitions(astDoc), make(map[string]bool))
+
+	switch op.Operation {
+	case ast.OperationTypeMutation:
+		operationInfo.Type = Mutation
+	case ast.OperationTypeSubscription:
+		operationInfo.Type = Subscription
+		if operationInfo.StreamCursorField != "" {
+			operationInfo.Type = Streaming
+		}
+		if operationInfo.IsAggregate {
+			operationInfo.Type = SubscriptionAggregate
+		}
+	default:
+		operationInfo.Type = Query
+	}
+
+	return operationInfo, nil
+}
+
+// getRootFields returns the fields at the root of the operation (including the ones inside inline fragments)
+func getRootFields(selectionSet *ast.SelectionSet) []*ast.Field {
+	fields := make([]*ast.Field, 0)
+	if selectionSet == nil {
+		return fields
+	}
+
+	for _, selection := range selectionSet.Selections {
+		switch sel := selection.(type) {
+		case *ast.Field:
+			fields = append(fields, sel)
+		case *ast.InlineFragment:
+			fields = append(fields, getRootFields(sel.SelectionSet)...)
+		}
+	}
+
+	return fields
+}
+
+// hasIntrospectionField checks the root selection, including the fragments spread on it
+func hasIntrospectionField(selectionSet *ast.SelectionSet, fragments map[string]*ast.FragmentDefinition, visitedFragments map[string]bool) bool {
+	if selectionSet == nil {
+		return false
+	}
+
+	for _, selection := range selectionSet.Selections {
+		switch sel := selection.(type) {
+		case *ast.Field:
+			if sel.Name.Value == "__schema" || sel.Name.Value == "__type" {
+				return true
+			}
+		case *ast.InlineFragment:
+			if hasIntrospectionField(sel.SelectionSet, fragments, visitedFragments) {
+				return true
+			}
+		case *ast.FragmentSpread:
+			fragment, exists := fragments[sel.Name.Value]
+			if !exists || visitedFragments[sel.Name.Value] {
+				continue
+			}
+			visitedFragments[sel.Name.Value] = true
+			if hasIntrospectionField(fragment.SelectionSet, fragments, visitedFragments) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func hasChildField(field *ast.Field, childName string) bool {
+	if field.SelectionSet == nil {
+		return false
+	}
+
+	for _, selection := range field.SelectionSet.Selections {
+		if child, ok := selection.(*ast.Field); ok && child.Name.Value == childName {
+			return true
+		}
+	}
+
+	return false
+}
+
+// setStreamCursorProps reads `cursor: {initial_value: {field: value}}` from the arguments of the `_stream` field
+func setStreamCursorProps(operationInfo *OperationInfo, streamField *ast.Field) {
+	initialValueField := GetStreamCursorInitialValueField(streamField)
+	if initialValueField == nil {
+		return
+	}
+
+	operationInfo.StreamCursorField = initialValueField.Name.Value
+	switch value := initialValueField.Value.(type) {
+	case *ast.Variable:
+		operationInfo.StreamCursorVariableName = value.Name.Value
+	case *ast.StringValue:
+		operationInfo.StreamCursorInlineValue = "\"" + value.Value + "\""
+	case *ast.IntValue:
+		operationInfo.StreamCursorInlineValue = value.Value
+	case *ast.FloatValue:
+		operationInfo.StreamCursorInlineValue = value.Value
+	case *ast.EnumValue:
+		operationInfo.StreamCursorInlineValue = value.Value
+	}
+}
+
+// GetStreamCursorInitialValueField returns the `field: value` inside `cursor: {initial_value: {...}}`
+func GetStreamCursorInitialValueField(streamField *ast.Field) *ast.ObjectField {
+	for _, argument := range streamField.Arguments {
+		if argument.Name.Value != "cursor" {
+			continue
+		}
+
+		// cursor can be an object or a list of objects
+		cursorValue := argument.Value
+		if cursorList, ok := cursorValue.(*ast.ListValue); ok && len(cursorList.Values) > 0 {
+			cursorValue = cursorList.Values[0]
+		}
+		cursorObject, ok := cursorValue.(*ast.ObjectValue)
+		if !ok {
+			return nil
+		}
+
+		for _, cursorField := range cursorObject.Fields {
+			if cursorField.Name.Value != "initial_value" {
+				continue
+			}
+
+			if initialValueObject, ok := cursorField.Value.(*ast.ObjectValue); ok && len(initialValueObject.Fields) > 0 {
+				return initialValueObject.Fields[0]
+			}
+		}
+	}
+
+	return nil
+}
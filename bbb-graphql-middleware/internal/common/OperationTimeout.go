@@ -0,0 +1,31 @@
+package common
+
+import (
+	"time"
+
+	"bbb-graphql-middleware/config"
+)
+
+var (
+	queryTimeout             = time.Duration(config.GetConfig().Server.QueryTimeoutSeconds) * time.Second
+	mutationTimeout          = time.Duration(config.GetConfig().Server.MutationTimeoutSeconds) * time.Second
+	operationTimeoutsSeconds = config.GetConfig().Server.OperationTimeoutsSeconds
+)
+
+// GetOperationTimeout returns how long the middleware waits for the answer of a query or mutation.
+// Subscriptions and streamings never time out, the same happens when it returns 0.
+func GetOperationTimeout(queryType QueryType, operationName string) time.Duration {
+	if queryType != Query && queryType != Mutation {
+		return 0
+	}
+
+	if timeoutSeconds, exists := operationTimeoutsSeconds[operationName]; exists {
+		return time.Duration(timeoutSeconds) * time.Second
+	}
+
+	if queryType == Mutation {
+		return mutationTimeout
+	}
+
+	return queryTimeout
+}
@@ -21,6 +21,13 @@ var (
 		Name: "ws_connection_accepted",
 		Help: "Total number of Websocket connections accepted",
 	})
+	HttpOriginRejectedCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "http_origin_rejected_total",
+			Help: "Total number of requests rejected because their origin is not authorized",
+		},
+		[]string{"endpoint", "origin"},
+	)
 	WsConnectionRejectedCounter = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "ws_connection_rejected",
@@ -28,6 +35,35 @@ var (
 		},
 		[]string{"reason"},
 	)
+	WsCompressionMessageBytesCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ws_compression_message_bytes_total",
+			Help: "Total size (in bytes) of Websocket messages before compression (sent) or after decompression (received)",
+		},
+		[]string{"endpoint", "direction", "mode"},
+	)
+	WsCompressionWireBytesCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ws_compression_wire_bytes_total",
+			Help: "Total size (in bytes) transferred over the network by Websocket connections",
+		},
+		[]string{"endpoint", "direction", "mode"},
+	)
+	WsCompressionWriteDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name: "ws_compression_write_duration_seconds",
+			Help: "Time spent writing (and compressing) a Websocket message",
+			Buckets: []float64{
+				0.0001,
+				0.0005,
+				0.001,
+				0.005,
+				0.01,
+				0.05,
+			},
+		},
+		[]string{"endpoint", "mode"},
+	)
 	GqlSubscribeCounter = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "gql_subscription_total",
@@ -42,6 +78,144 @@ var (
 		},
 		[]string{"operationName"},
 	)
+	GqlOperationTimeoutCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gql_operation_timeout_total",
+			Help: "Total number of Graphql queries and mutations that timed out waiting for an answer",
+		},
+		[]string{"type", "operationName"},
+	)
+	GqlSubscriptionCacheCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gql_subscription_cache_total",
+			Help: "Total number of lookups in the subscription warm start cache",
+		},
+		[]string{"result"},
+	)
+	GqlPersistedQueryCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gql_persisted_query_total",
+			Help: "Total number of operations checked against the persisted queries manifest",
+		},
+		[]string{"result"},
+	)
+	GqlMutationRateLimitedCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gql_mutation_rate_limited_total",
+			Help: "Total number of mutations rejected by the rate limits (rule `default` is max_connection_mutations_per_minute)",
+		},
+		[]string{"rule"},
+	)
+	GqlQueryCostRejectedCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gql_query_cost_rejected_total",
+			Help: "Total number of queries rejected because of their cost",
+		},
+		[]string{"reason", "operationName"},
+	)
+	GqlIntrospectionCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gql_introspection_total",
+			Help: "Total number of introspection queries received",
+		},
+		[]string{"role", "result"},
+	)
+	GqlAbuseViolationsCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gql_abuse_violations_total",
+			Help: "Total number of violations counted in the abuse score of sessions",
+		},
+		[]string{"reason"},
+	)
+	GqlAbuseDisconnectionsCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "gql_abuse_disconnections_total",
+			Help: "Total number of sessions disconnected because their abuse score reached the threshold",
+		},
+	)
+	GqlActionsConnectionsCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gql_actions_connections_total",
+			Help: "Total number of connections used to send requests to graphql-actions (reused from the pool or new)",
+		},
+		[]string{"reused"},
+	)
+	GqlActionsRetriesCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gql_actions_retries_total",
+			Help: "Total number of actions sent again to graphql-actions after a transient failure",
+		},
+		[]string{"action"},
+	)
+	GqlActionsCircuitOpenGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "gql_actions_circuit_open",
+			Help: "1 while the circuit of graphql-actions is open (requests fail right away)",
+		},
+	)
+	GqlActionsOutboxDepthGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "gql_actions_outbox_depth",
+			Help: "Number of mutations waiting in the outbox for graphql-actions to be available",
+		},
+	)
+	GqlActionsOutboxRejectedCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gql_actions_outbox_rejected_total",
+			Help: "Total number of mutations that failed instead of waiting in the outbox",
+		},
+		[]string{"reason"},
+	)
+	GqlActionsOutboxReplayLatency = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "gql_actions_outbox_replay_latency_seconds",
+			Help:    "Time the mutations waited in the outbox until they were sent to graphql-actions",
+			Buckets: []float64{0.5, 1, 2.5, 5, 10, 20, 30, 60, 120},
+		},
+	)
+	GqlAuditRecordsCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gql_audit_records_total",
+			Help: "Total number of audit records of actions (written, dropped as the sink is slow or failed)",
+		},
+		[]string{"result"},
+	)
+	GqlActionsRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name: "gql_actions_request_duration_seconds",
+			Help: "Time to receive the response of graphql-actions",
+			Buckets: []float64{
+				0.005,
+				0.01,
+				0.025,
+				0.05,
+				0.1,
+				0.25,
+				0.5,
+				1,
+				2.5,
+				5,
+				10,
+			},
+		},
+		[]string{"action", "status"},
+	)
+	GqlActionsBatchSize = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name: "gql_actions_batch_size",
+			Help: "Number of mutations sent to graphql-actions in each batch",
+			Buckets: []float64{
+				1,
+				2,
+				5,
+				10,
+				20,
+				50,
+				100,
+			},
+		},
+		[]string{"action"},
+	)
 	GqlReceivedDataCounter = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "gql_received_data_total",
@@ -102,9 +276,38 @@ func init() {
 	prometheus.MustRegister(HttpConnectionCounter)
 	prometheus.MustRegister(WsConnectionAcceptedCounter)
 	prometheus.MustRegister(WsConnectionRejectedCounter)
+	prometheus.MustRegister(HttpOriginRejectedCounter)
+	if websocketCompressionMetricsEnabled {
+		prometheus.MustRegister(WsCompressionMessageBytesCounter)
+		prometheus.MustRegister(WsCompressionWireBytesCounter)
+		prometheus.MustRegister(WsCompressionWriteDuration)
+	}
 	prometheus.MustRegister(GqlSubscribeCounter)
 	prometheus.MustRegister(GqlReceivedDataCounter)
 	prometheus.MustRegister(GqlMutationsCounter)
+	prometheus.MustRegister(GqlMutationRateLimitedCounter)
+	prometheus.MustRegister(GqlOperationTimeoutCounter)
+	prometheus.MustRegister(GqlQueryCostRejectedCounter)
+	prometheus.MustRegister(GqlIntrospectionCounter)
+	prometheus.MustRegister(GqlAbuseViolationsCounter)
+	prometheus.MustRegister(GqlAbuseDisconnectionsCounter)
+	prometheus.MustRegister(GqlActionsConnectionsCounter)
+	prometheus.MustRegister(GqlActionsRequestDuration)
+	prometheus.MustRegister(GqlActionsRetriesCounter)
+	prometheus.MustRegister(GqlActionsCircuitOpenGauge)
+	prometheus.MustRegister(GqlActionsOutboxDepthGauge)
+	prometheus.MustRegister(GqlActionsOutboxRejectedCounter)
+	prometheus.MustRegister(GqlActionsOutboxReplayLatency)
+	if config.GetConfig().Audit.Sink != "" && config.GetConfig().Audit.Sink != "disabled" {
+		prometheus.MustRegister(GqlAuditRecordsCounter)
+	}
+	prometheus.MustRegister(GqlActionsBatchSize)
+	if SubscriptionCacheEnabled {
+		prometheus.MustRegister(GqlSubscriptionCacheCounter)
+	}
+	if config.GetConfig().Server.PersistedQueriesManifestPath != "" {
+		prometheus.MustRegister(GqlPersistedQueryCounter)
+	}
 	prometheus.MustRegister(GqlReceivedDataPayloadSize)
 	if PrometheusAdvancedMetricsEnabled {
 		prometheus.MustRegister(GqlReceivedDataPayloadLength)
@@ -0,0 +1,220 @@
+package common
+
+import (
+	"math"
+	"strconv"
+
+	"bbb-graphql-middleware/config"
+
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// Cost of a query, estimated from the parsed query (without the schema):
+// each field costs its weight (1 by default), and the cost of the fields selected inside a relationship
+// is multiplied by the number of rows it can return (`limit` or `batch_size` arguments, or the default list size)
+
+var (
+	queryCostFieldWeights    = config.GetConfig().Server.QueryCostFieldWeights
+	queryCostDefaultListSize = max(config.GetConfig().Server.QueryCostDefaultListSize, 1)
+)
+
+// GetFragmentDefinitions returns the fragments declared in the document (by name)
+func GetFragmentDefinitions(astDoc *ast.Document) map[string]*ast.FragmentDefinition {
+	fragments := make(map[string]*ast.FragmentDefinition)
+	for _, def := range astDoc.Definitions {
+		if fragment, ok := def.(*ast.FragmentDefinition); ok && fragment.Name != nil {
+			fragments[fragment.Name.Value] = fragment
+		}
+	}
+
+	return fragments
+}
+
+// HasFragmentCycle returns true when a fragment spreads itself (directly or through other fragments),
+// which is not allowed by the spec (and would expand forever)
+func HasFragmentCycle(fragments map[string]*ast.FragmentDefinition) bool {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int, len(fragments))
+
+	var hasCycle func(name string) bool
+	hasCycle = func(name string) bool {
+		switch state[name] {
+		case visiting:
+			return true
+		case visited:
+			return false
+		}
+
+		fragment, exists := fragments[name]
+		if !exists {
+			return false
+		}
+
+		state[name] = visiting
+		for _, spreadName := range getFragmentSpreads(fragment.SelectionSet, nil) {
+			if hasCycle(spreadName) {
+				return true
+			}
+		}
+		state[name] = visited
+
+		return false
+	}
+
+	for name := range fragments {
+		if hasCycle(name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func getFragmentSpreads(selectionSet *ast.SelectionSet, spreads []string) []string {
+	if selectionSet == nil {
+		return spreads
+	}
+
+	for _, selection := range selectionSet.Selections {
+		switch sel := selection.(type) {
+		case *ast.Field:
+			spreads = getFragmentSpreads(sel.SelectionSet, spreads)
+		case *ast.InlineFragment:
+			spreads = getFragmentSpreads(sel.SelectionSet, spreads)
+		case *ast.FragmentSpread:
+			spreads = append(spreads, sel.Name.Value)
+		}
+	}
+
+	return spreads
+}
+
+// CalculateQueryCost estimates the cost of the operation, resolving the fragments declared in the document
+// The cost saturates at the ceiling (any cost above it will be rejected anyway), 0 uses math.MaxInt32
+func CalculateQueryCost(operationInfo *OperationInfo, variables map[string]interface{}, ceiling int) int {
+	if ceiling <= 0 {
+		ceiling = math.MaxInt32
+	}
+
+	calculator := &queryCostCalculator{
+		fragments:     GetFragmentDefinitions(operationInfo.Document),
+		fragmentCosts: make(map[string]int),
+		variables:     variables,
+		ceiling:       ceiling,
+	}
+
+	return calculator.selectionSetCost(operationInfo.Operation.SelectionSet)
+}
+
+type queryCostCalculator struct {
+	fragments     map[string]*ast.FragmentDefinition
+	fragmentCosts map[string]int // each fragment is calculated once, no matter how many times it's spread
+	variables     map[string]interface{}
+	ceiling       int
+}
+
+func (c *queryCostCalculator) selectionSetCost(selectionSet *ast.SelectionSet) int {
+	if selectionSet == nil {
+		return 0
+	}
+
+	cost := 0
+	for _, selection := range selectionSet.Selections {
+		switch sel := selection.(type) {
+		case *ast.Field:
+			cost = c.add(cost, getFieldWeight(sel.Name.Value))
+			if sel.SelectionSet != nil {
+				cost = c.add(cost, c.multiply(c.getFieldListSize(sel), c.selectionSetCost(sel.SelectionSet)))
+			}
+		case *ast.InlineFragment:
+			cost = c.add(cost, c.selectionSetCost(sel.SelectionSet))
+		case *ast.FragmentSpread:
+			cost = c.add(cost, c.fragmentCost(sel.Name.Value))
+		}
+
+		if cost >= c.ceiling {
+			return c.ceiling
+		}
+	}
+
+	return cost
+}
+
+func (c *queryCostCalculator) fragmentCost(name string) int {
+	if cost, calculated := c.fragmentCosts[name]; calculated {
+		return cost
+	}
+
+	fragment, exists := c.fragments[name]
+	if !exists {
+		return 0
+	}
+
+	// Stored before calculating, so a cycle (rejected before) doesn't recurse forever
+	c.fragmentCosts[name] = 0
+	cost := c.selectionSetCost(fragment.SelectionSet)
+	c.fragmentCosts[name] = cost
+
+	return cost
+}
+
+func (c *queryCostCalculator) add(a, b int) int {
+	if a >= c.ceiling-b {
+		return c.ceiling
+	}
+
+	return a + b
+}
+
+func (c *queryCostCalculator) multiply(a, b int) int {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	if a >= c.ceiling/b+1 {
+		return c.ceiling
+	}
+
+	return min(a*b, c.ceiling)
+}
+
+func getFieldWeight(fieldName string) int {
+	if weight, exists := queryCostFieldWeights[fieldName]; exists {
+		return max(weight, 0)
+	}
+
+	// `__typename` is added by the client to every selection and costs nothing
+	if fieldName == "__typename" {
+		return 0
+	}
+
+	return 1
+}
+
+func (c *queryCostCalculator) getFieldListSize(field *ast.Field) int {
+	for _, argument := range field.Arguments {
+		if argument.Name.Value != "limit" && argument.Name.Value != "batch_size" {
+			continue
+		}
+
+		switch value := argument.Value.(type) {
+		case *ast.IntValue:
+			size, err := strconv.Atoi(value.Value)
+			if err != nil {
+				// Out of range
+				return c.ceiling
+			}
+			if size > 0 {
+				return min(size, c.ceiling)
+			}
+		case *ast.Variable:
+			if size, ok := c.variables[value.Name.Value].(float64); ok && size > 0 {
+				return int(min(size, float64(c.ceiling)))
+			}
+		}
+	}
+
+	return queryCostDefaultListSize
+}
@@ -0,0 +1,127 @@
+package common
+
+import (
+	"math"
+	"testing"
+
+	_ "bbb-graphql-middleware/config/configtest"
+)
+
+func TestCalculateQueryCost(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		variables map[string]interface{}
+		ceiling   int
+		expected  int
+	}{
+		{
+			name:     "fields",
+			query:    `query q { user_current { userId name __typename } }`,
+			expected: 3, // user_current + userId + name (__typename is free)
+		},
+		{
+			name:     "limit multiplies the relationship",
+			query:    `query q { user(limit: 10) { userId name } }`,
+			expected: 21,
+		},
+		{
+			name:      "limit from variable",
+			query:     `query q($limit: Int) { user(limit: $limit) { userId } }`,
+			variables: map[string]interface{}{"limit": float64(50)},
+			expected:  51,
+		},
+		{
+			name:     "nested limits",
+			query:    `query q { meeting(limit: 2) { users(limit: 10) { userId } } }`,
+			expected: 1 + 2*(1+10*1),
+		},
+		{
+			name: "fragment spread many times",
+			query: `query q { a: user(limit: 2) { ...UserFields } b: user(limit: 3) { ...UserFields } }
+				fragment UserFields on user { userId name }`,
+			expected: (1 + 2*2) + (1 + 3*2),
+		},
+		{
+			name:     "saturates at the ceiling",
+			query:    `query q { user(limit: 1000) { userId name } }`,
+			ceiling:  100,
+			expected: 100,
+		},
+		{
+			name:     "limit out of range",
+			query:    `query q { user(limit: 99999999999999999999) { userId } }`,
+			expected: math.MaxInt32,
+		},
+		{
+			name: "fragments doubling each level",
+			query: `query q { user(limit: 1000) { ...F0 } }
+				fragment F0 on user { a: user(limit: 1000) { ...F1 } b: user(limit: 1000) { ...F1 } }
+				fragment F1 on user { a: user(limit: 1000) { ...F2 } b: user(limit: 1000) { ...F2 } }
+				fragment F2 on user { a: user(limit: 1000) { userId } b: user(limit: 1000) { userId } }`,
+			ceiling:  1000,
+			expected: 1000,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			operationInfo, err := GetOperationInfo(tt.query, "q")
+			if err != nil {
+				t.Fatalf("failed to parse query: %v", err)
+			}
+
+			if cost := CalculateQueryCost(operationInfo, tt.variables, tt.ceiling); cost != tt.expected {
+				t.Errorf("expected cost %d, got %d", tt.expected, cost)
+			}
+		})
+	}
+}
+
+func TestHasFragmentCycle(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		expected bool
+	}{
+		{
+			name:     "no fragments",
+			query:    `query q { user { userId } }`,
+			expected: false,
+		},
+		{
+			name: "fragment spread twice",
+			query: `query q { user { ...A ...B } }
+				fragment A on user { userId ...B }
+				fragment B on user { name }`,
+			expected: false,
+		},
+		{
+			name: "fragment spreads itself",
+			query: `query q { user { ...A } }
+				fragment A on user { userId user { ...A } }`,
+			expected: true,
+		},
+		{
+			name: "fragments spread each other",
+			query: `query q { user { ...A } }
+				fragment A on user { ... on user { ...B } }
+				fragment B on user { user { ...C } }
+				fragment C on user { ...A }`,
+			expected: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			astDoc, err := ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("failed to parse query: %v", err)
+			}
+
+			if hasCycle := HasFragmentCycle(GetFragmentDefinitions(astDoc)); hasCycle != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, hasCycle)
+			}
+		})
+	}
+}
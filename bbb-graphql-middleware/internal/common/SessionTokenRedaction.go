@@ -0,0 +1,72 @@
+package common
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+
+	"bbb-graphql-middleware/config"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Session tokens allow to join the meeting as the user, so they are not written in the logs:
+// `hash` writes a keyed hash (that can be looked up in /admin/connections), `prefix` only the first characters
+
+var (
+	sessionTokenRedactionMode = config.GetConfig().Server.SessionTokenLogRedaction
+	sessionTokenHashKey       = []byte(config.GetConfig().Server.SessionTokenHashKey)
+	sessionTokenJsonRegex     = regexp.MustCompile(`("(?:sessionToken|X-Session-Token|x-session-token)"\s*:\s*")([^"]*)(")`)
+)
+
+func init() {
+	if len(sessionTokenHashKey) == 0 {
+		// Hashes will change after restarting, set session_token_hash_key to keep them
+		sessionTokenHashKey = make([]byte, 32)
+		if _, err := rand.Read(sessionTokenHashKey); err != nil {
+			log.Fatalf("Error generating the session token hash key: %v", err)
+		}
+	}
+}
+
+// HashSessionToken returns the keyed hash of the session token (used to look up connections without exposing it)
+func HashSessionToken(sessionToken string) string {
+	mac := hmac.New(sha256.New, sessionTokenHashKey)
+	mac.Write([]byte(sessionToken))
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// RedactSessionToken returns the session token as it should be written in the logs
+func RedactSessionToken(sessionToken string) string {
+	if sessionToken == "" {
+		return ""
+	}
+
+	switch sessionTokenRedactionMode {
+	case "plain":
+		return sessionToken
+	case "prefix":
+		if len(sessionToken) <= 4 {
+			return "***"
+		}
+		return sessionToken[:4] + "***"
+	default:
+		return HashSessionToken(sessionToken)
+	}
+}
+
+// RedactSessionTokensInJson redacts the session tokens of a json message (e.g. connection_init or Redis messages) before logging it
+func RedactSessionTokensInJson(message string) string {
+	if sessionTokenRedactionMode == "plain" ||
+		(!strings.Contains(message, "essionToken") && !strings.Contains(message, "ession-Token") && !strings.Contains(message, "ession-token")) {
+		return message
+	}
+
+	return sessionTokenJsonRegex.ReplaceAllStringFunc(message, func(match string) string {
+		parts := sessionTokenJsonRegex.FindStringSubmatch(match)
+		return parts[1] + RedactSessionToken(parts[2]) + parts[3]
+	})
+}
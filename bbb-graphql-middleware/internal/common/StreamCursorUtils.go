@@ -5,31 +5,30 @@ import (
 	"fmt"
 	log "github.com/sirupsen/logrus"
 	"hash/crc32"
-	"regexp"
 	"strconv"
 	"strings"
+
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/printer"
 )
 
 func GetStreamCursorPropsFromBrowserMessage(browserMessage BrowserSubscribeMessage) (string, string, interface{}) {
-	streamCursorField := ""
-	streamCursorVariableName := ""
 	var streamCursorInitialValue interface{}
 
-	cursorInitialValueRePattern := regexp.MustCompile(`cursor:\s*\{\s*initial_value\s*:\s*\{\s*([^:]+):\s*([^}]+)\s*}\s*}`)
-	matches := cursorInitialValueRePattern.FindStringSubmatch(browserMessage.Payload.Query)
-	if matches != nil {
-		streamCursorField = matches[1]
-		if strings.HasPrefix(matches[2], "$") {
-			streamCursorVariableName, _ = strings.CutPrefix(matches[2], "$")
-			if targetVariableValue, okTargetVariableValue := browserMessage.Payload.Variables[streamCursorVariableName]; okTargetVariableValue {
-				streamCursorInitialValue = targetVariableValue
-			}
-		} else {
-			streamCursorInitialValue = matches[2]
+	operationInfo, err := GetOperationInfo(browserMessage.Payload.Query, browserMessage.Payload.OperationName)
+	if err != nil || operationInfo.StreamCursorField == "" {
+		return "", "", nil
+	}
+
+	if operationInfo.StreamCursorVariableName != "" {
+		if targetVariableValue, okTargetVariableValue := browserMessage.Payload.Variables[operationInfo.StreamCursorVariableName]; okTargetVariableValue {
+			streamCursorInitialValue = targetVariableValue
 		}
+	} else {
+		streamCursorInitialValue = operationInfo.StreamCursorInlineValue
 	}
 
-	return streamCursorField, streamCursorVariableName, streamCursorInitialValue
+	return operationInfo.StreamCursorField, operationInfo.StreamCursorVariableName, streamCursorInitialValue
 }
 
 func GetLastStreamCursorValueFromReceivedMessage(message []byte, streamCursorField string) interface{} {
@@ -76,19 +75,30 @@ func GetLastStreamCursorValueFromReceivedMessage(message []byte, streamCursorFie
 	return lastStreamCursorValue
 }
 
-func PatchQueryIncludingCursorField(originalQuery string, cursorField string) string {
+func PatchQueryIncludingCursorField(originalQuery string, operationName string, cursorField string) string {
 	if cursorField == "" {
 		return originalQuery
 	}
 
-	lastIndexOfTypename := LastButOneIndex(originalQuery, "}")
-	if lastIndexOfTypename == -1 {
+	// Parse again because the document of GetOperationInfo is shared and can't be modified
+	astDoc, err := ParseQuery(originalQuery)
+	if err != nil {
+		return originalQuery
+	}
+
+	streamField := getStreamRootField(GetOperationDefinition(astDoc, operationName))
+	if streamField == nil || streamField.SelectionSet == nil {
 		return originalQuery
 	}
 
 	// It will include the cursorField at the end of the list of fields
-	// It's not a problem if the field be duplicated in the list, Hasura just ignore the second occurrence
-	return originalQuery[:lastIndexOfTypename] + "  " + cursorField + "\n  " + originalQuery[lastIndexOfTypename:]
+	if !hasChildField(streamField, cursorField) {
+		streamField.SelectionSet.Selections = append(streamField.SelectionSet.Selections, ast.NewField(&ast.Field{
+			Name: ast.NewName(&ast.Name{Value: cursorField}),
+		}))
+	}
+
+	return fmt.Sprintf("%v", printer.Print(astDoc))
 }
 
 func PatchQuerySettingLastCursorValue(subscription GraphQlSubscription) []byte {
@@ -107,46 +117,40 @@ func PatchQuerySettingLastCursorValue(subscription GraphQlSubscription) []byte {
 		browserMessage.Payload.Variables[subscription.StreamCursorVariableName] = subscription.StreamCursorCurrValue
 	} else {
 		/**** This stream has its cursor value set through inline value (not variables) ****/
-		cursorInitialValueRePattern := regexp.MustCompile(`cursor:\s*\{\s*initial_value\s*:\s*\{\s*([^:]+:\s*[^}]+)\s*}\s*}`)
-		newValue := ""
-
-		replaceInitialValueFunc := func(match string) string {
-			switch v := subscription.StreamCursorCurrValue.(type) {
-			case string:
-				newValue = v
+		var newValue ast.Value
+		switch v := subscription.StreamCursorCurrValue.(type) {
+		case string:
+			newValue = ast.NewStringValue(&ast.StringValue{Value: strings.Trim(v, "\"")})
+		case int:
+			newValue = ast.NewIntValue(&ast.IntValue{Value: strconv.Itoa(v)})
+		case float32:
+			newValue = ast.NewFloatValue(&ast.FloatValue{Value: strconv.FormatFloat(float64(v), 'f', -1, 32)})
+		case float64:
+			newValue = ast.NewFloatValue(&ast.FloatValue{Value: strconv.FormatFloat(v, 'f', -1, 64)})
+		default:
+			return subscription.Message
+		}
 
-				//Append quotes if it is missing, it will be necessary when appending to the query
-				if !strings.HasPrefix(v, "\"") {
-					newValue = "\"" + newValue
-				}
-				if !strings.HasSuffix(v, "\"") {
-					newValue = newValue + "\""
-				}
-			case int:
-				newValue = strconv.Itoa(v)
-			case float32:
-				myFloat64 := float64(v)
-				newValue = strconv.FormatFloat(myFloat64, 'f', -1, 32)
-			case float64:
-				newValue = strconv.FormatFloat(v, 'f', -1, 64)
-			default:
-				newValue = ""
-			}
+		astDoc, err := ParseQuery(browserMessage.Payload.Query)
+		if err != nil {
+			return subscription.Message
+		}
 
-			if newValue != "" {
-				replacement := subscription.StreamCursorField + ": " + newValue
-				return fmt.Sprintf("cursor: {initial_value: {%s}}", replacement)
-			} else {
-				return match
-			}
+		streamField := getStreamRootField(GetOperationDefinition(astDoc, browserMessage.Payload.OperationName))
+		if streamField == nil {
+			return subscription.Message
 		}
 
-		newQuery := cursorInitialValueRePattern.ReplaceAllStringFunc(browserMessage.Payload.Query, replaceInitialValueFunc)
-		if browserMessage.Payload.Query == newQuery {
+		initialValueField := GetStreamCursorInitialValueField(streamField)
+		if initialValueField == nil || initialValueField.Name.Value != subscription.StreamCursorField {
+			return subscription.Message
+		}
+		if fmt.Sprintf("%v", printer.Print(initialValueField.Value)) == fmt.Sprintf("%v", printer.Print(newValue)) {
 			return subscription.Message
 		}
+		initialValueField.Value = newValue
 
-		browserMessage.Payload.Query = newQuery
+		browserMessage.Payload.Query = fmt.Sprintf("%v", printer.Print(astDoc))
 	}
 
 	newMessageJson, _ := json.Marshal(browserMessage)
@@ -154,6 +158,20 @@ func PatchQuerySettingLastCursorValue(subscription GraphQlSubscription) []byte {
 	return newMessageJson
 }
 
+func getStreamRootField(op *ast.OperationDefinition) *ast.Field {
+	if op == nil {
+		return nil
+	}
+
+	for _, rootField := range getRootFields(op.SelectionSet) {
+		if strings.HasSuffix(rootField.Name.Value, "_stream") {
+			return rootField
+		}
+	}
+
+	return nil
+}
+
 func LastButOneIndex(s, substr string) int {
 	last := strings.LastIndex(s, substr)
 	if last == -1 {
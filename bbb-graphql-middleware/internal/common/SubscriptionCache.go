@@ -0,0 +1,138 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"bbb-graphql-middleware/config"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Cache of the latest result of each subscription, shared among all connections
+// It allows new subscriptions to receive the data immediately (warm start) instead of waiting for Hasura
+
+var (
+	SubscriptionCacheEnabled          = config.GetConfig().Server.SubscriptionCacheEnabled
+	subscriptionCacheTtl              = time.Duration(config.GetConfig().Server.SubscriptionCacheTtlSeconds) * time.Second
+	subscriptionCacheSessionVariables = splitSessionVariablesList(config.GetConfig().Server.SubscriptionCacheSessionVariables)
+	subscriptionCacheOperationsVars   = make(map[string][]string)
+)
+
+func init() {
+	for operationName, sessionVariables := range config.GetConfig().Server.SubscriptionCacheOperationsVariables {
+		subscriptionCacheOperationsVars[operationName] = splitSessionVariablesList(sessionVariables)
+	}
+
+	if SubscriptionCacheEnabled {
+		go removeExpiredSubscriptionCache()
+	}
+}
+
+type SubscriptionCacheEntry struct {
+	Message      []byte        // message received from Hasura, with QUERY-ID placeholder instead of the query id
+	DataChecksum uint32        // checksum of Message
+	Data         HasuraMessage // Message parsed
+	StoredAt     time.Time
+}
+
+var subscriptionCache = make(map[string]SubscriptionCacheEntry)
+var subscriptionCacheMutex sync.RWMutex
+
+// GetSubscriptionCacheKey identifies subscriptions that will receive the same result from Hasura
+// (same operation, query and variables, executed with the same permission-relevant session variables)
+func GetSubscriptionCacheKey(browserMessage BrowserSubscribeMessage, sessionVariables map[string]string) string {
+	variablesJson, _ := json.Marshal(browserMessage.Payload.Variables) // map keys are sorted by json.Marshal
+	queryHash := sha256.Sum256([]byte(browserMessage.Payload.Query))
+
+	keyVariables, exists := subscriptionCacheOperationsVars[browserMessage.Payload.OperationName]
+	if !exists {
+		keyVariables = subscriptionCacheSessionVariables
+	}
+	if len(keyVariables) == 0 {
+		for sessionVariable := range sessionVariables {
+			keyVariables = append(keyVariables, sessionVariable)
+		}
+		sort.Strings(keyVariables)
+	}
+
+	var key strings.Builder
+	key.WriteString(browserMessage.Payload.OperationName)
+	key.WriteString("\n")
+	key.WriteString(hex.EncodeToString(queryHash[:]))
+	key.WriteString("\n")
+	key.Write(variablesJson)
+	for _, sessionVariable := range keyVariables {
+		key.WriteString("\n")
+		key.WriteString(sessionVariable)
+		key.WriteString("=")
+		key.WriteString(sessionVariables[sessionVariable])
+	}
+
+	keyHash := sha256.Sum256([]byte(key.String()))
+	return hex.EncodeToString(keyHash[:])
+}
+
+func GetSubscriptionCache(cacheKey string) (SubscriptionCacheEntry, bool) {
+	subscriptionCacheMutex.RLock()
+	entry, exists := subscriptionCache[cacheKey]
+	subscriptionCacheMutex.RUnlock()
+
+	if exists && time.Since(entry.StoredAt) > subscriptionCacheTtl {
+		exists = false
+	}
+
+	result := "miss"
+	if exists {
+		result = "hit"
+	}
+	GqlSubscriptionCacheCounter.With(prometheus.Labels{"result": result}).Inc()
+
+	return entry, exists
+}
+
+func StoreSubscriptionCache(cacheKey string, message []byte, dataChecksum uint32, data HasuraMessage) {
+	storedAt := time.Now()
+
+	subscriptionCacheMutex.Lock()
+	subscriptionCache[cacheKey] = SubscriptionCacheEntry{
+		Message:      message,
+		DataChecksum: dataChecksum,
+		Data:         data,
+		StoredAt:     storedAt,
+	}
+	subscriptionCacheMutex.Unlock()
+}
+
+// removeExpiredSubscriptionCache removes the entries older than the TTL (expired entries are ignored on read meanwhile)
+func removeExpiredSubscriptionCache() {
+	ticker := time.NewTicker(max(subscriptionCacheTtl, time.Second))
+	defer ticker.Stop()
+
+	for range ticker.C {
+		subscriptionCacheMutex.Lock()
+		for cacheKey, entry := range subscriptionCache {
+			if time.Since(entry.StoredAt) > subscriptionCacheTtl {
+				delete(subscriptionCache, cacheKey)
+			}
+		}
+		subscriptionCacheMutex.Unlock()
+	}
+}
+
+func splitSessionVariablesList(sessionVariables string) []string {
+	list := make([]string, 0)
+	for _, sessionVariable := range strings.Split(sessionVariables, ",") {
+		if sessionVariable = strings.ToLower(strings.TrimSpace(sessionVariable)); sessionVariable != "" {
+			list = append(list, sessionVariable)
+		}
+	}
+	sort.Strings(list)
+
+	return list
+}
@@ -0,0 +1,175 @@
+package common
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"bbb-graphql-middleware/config"
+
+	"github.com/coder/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+// Endpoints of the websockets handled by the middleware (used as metric labels)
+const (
+	WebsocketEndpointBrowser = "browser"
+	WebsocketEndpointHasura  = "hasura"
+)
+
+var (
+	BrowserWebsocketCompressionMode      = ParseWebsocketCompressionMode(config.GetConfig().Server.WebsocketCompressionMode)
+	BrowserWebsocketCompressionThreshold = config.GetConfig().Server.WebsocketCompressionThreshold
+	HasuraWebsocketCompressionMode       = ParseWebsocketCompressionMode(config.GetConfig().Hasura.WebsocketCompressionMode)
+	HasuraWebsocketCompressionThreshold  = config.GetConfig().Hasura.WebsocketCompressionThreshold
+	websocketCompressionMetricsEnabled   = BrowserWebsocketCompressionMode != websocket.CompressionDisabled ||
+		HasuraWebsocketCompressionMode != websocket.CompressionDisabled
+)
+
+// ParseWebsocketCompressionMode converts the mode from config (disabled, context_takeover or no_context_takeover)
+func ParseWebsocketCompressionMode(mode string) websocket.CompressionMode {
+	switch strings.ToLower(strings.TrimSpace(mode)) {
+	case "", "disabled":
+		return websocket.CompressionDisabled
+	case "context_takeover":
+		return websocket.CompressionContextTakeover
+	case "no_context_takeover":
+		return websocket.CompressionNoContextTakeover
+	default:
+		log.Warnf("Invalid websocket compression mode %s, compression will be disabled", mode)
+		return websocket.CompressionDisabled
+	}
+}
+
+func getWebsocketCompressionModeLabel(endpoint string) string {
+	mode := BrowserWebsocketCompressionMode
+	if endpoint == WebsocketEndpointHasura {
+		mode = HasuraWebsocketCompressionMode
+	}
+
+	switch mode {
+	case websocket.CompressionContextTakeover:
+		return "context_takeover"
+	case websocket.CompressionNoContextTakeover:
+		return "no_context_takeover"
+	default:
+		return "disabled"
+	}
+}
+
+// ObserveWebsocketMessage registers the size of a message before compression (or after decompression)
+// Comparing it with the bytes transferred over the wire gives the compression ratio
+func ObserveWebsocketMessage(endpoint string, direction string, messageSize int) {
+	if !websocketCompressionMetricsEnabled {
+		return
+	}
+
+	WsCompressionMessageBytesCounter.WithLabelValues(endpoint, direction, getWebsocketCompressionModeLabel(endpoint)).Add(float64(messageSize))
+}
+
+// ObserveWebsocketWrite registers how long it took to write a message (including the time spent compressing it)
+func ObserveWebsocketWrite(endpoint string, startedAt time.Time) {
+	if !websocketCompressionMetricsEnabled {
+		return
+	}
+
+	WsCompressionWriteDuration.WithLabelValues(endpoint, getWebsocketCompressionModeLabel(endpoint)).Observe(time.Since(startedAt).Seconds())
+}
+
+// wireCountingConn counts the bytes effectively transferred over the network
+type wireCountingConn struct {
+	net.Conn
+	receivedBytes prometheus.Counter
+	sentBytes     prometheus.Counter
+	pending       []byte // data already buffered by the http server when the connection was hijacked
+}
+
+func newWireCountingConn(netConn net.Conn, endpoint string) *wireCountingConn {
+	modeLabel := getWebsocketCompressionModeLabel(endpoint)
+	return &wireCountingConn{
+		Conn:          netConn,
+		receivedBytes: WsCompressionWireBytesCounter.WithLabelValues(endpoint, "received", modeLabel),
+		sentBytes:     WsCompressionWireBytesCounter.WithLabelValues(endpoint, "sent", modeLabel),
+	}
+}
+
+func (c *wireCountingConn) Read(b []byte) (int, error) {
+	if len(c.pending) > 0 {
+		n := copy(b, c.pending)
+		c.pending = c.pending[n:]
+		return n, nil
+	}
+
+	n, err := c.Conn.Read(b)
+	c.receivedBytes.Add(float64(n))
+	return n, err
+}
+
+func (c *wireCountingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.sentBytes.Add(float64(n))
+	return n, err
+}
+
+// wireCountingResponseWriter intercepts the Hijack (made by websocket.Accept) to count the bytes of the browser connection
+type wireCountingResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (w *wireCountingResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *wireCountingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("http.ResponseWriter does not implement http.Hijacker")
+	}
+
+	netConn, brw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	countingConn := newWireCountingConn(netConn, WebsocketEndpointBrowser)
+	if buffered := brw.Reader.Buffered(); buffered > 0 {
+		pending, _ := brw.Reader.Peek(buffered)
+		countingConn.pending = append([]byte(nil), pending...)
+	}
+
+	return countingConn, bufio.NewReadWriter(bufio.NewReader(countingConn), bufio.NewWriter(countingConn)), nil
+}
+
+// WrapResponseWriterForCompressionMetrics returns a ResponseWriter that counts the bytes of the browser websocket
+func WrapResponseWriterForCompressionMetrics(w http.ResponseWriter) http.ResponseWriter {
+	if !websocketCompressionMetricsEnabled {
+		return w
+	}
+
+	return &wireCountingResponseWriter{ResponseWriter: w}
+}
+
+var hasuraWireCountingTransport = &http.Transport{
+	DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+		netConn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return newWireCountingConn(netConn, WebsocketEndpointHasura), nil
+	},
+}
+
+// GetHasuraTransportForCompressionMetrics returns an http.Transport that counts the bytes of the Hasura websocket
+// It returns nil (default transport) when compression metrics are disabled
+func GetHasuraTransportForCompressionMetrics() http.RoundTripper {
+	if !websocketCompressionMetricsEnabled {
+		return nil
+	}
+
+	return hasuraWireCountingTransport
+}
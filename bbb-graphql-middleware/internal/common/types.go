@@ -22,6 +22,9 @@ const (
 	Mutation              QueryType = "mutation"
 )
 
+// QueryIdPlaceholderInBytes replaces the query id in messages that are cached or shared among connections
+var QueryIdPlaceholderInBytes = []byte("--------------QUERY-ID--------------") // 36 chars
+
 type GraphQlSubscription struct {
 	Id                         string
 	Message                    []byte
@@ -32,8 +35,12 @@ type GraphQlSubscription struct {
 	StreamCursorCurrValue      interface{}
 	LastReceivedData           HasuraMessage
 	LastReceivedDataChecksum   uint32
-	JsonPatchSupported         bool   // indicate if client support Json Patch for this subscription
-	LastSeenOnHasuraConnection string // id of the hasura connection that this query was active
+	JsonPatchSupported         bool        // indicate if client support Json Patch for this subscription
+	LastSeenOnHasuraConnection string      // id of the hasura connection that this query was active
+	TimeoutTimer               *time.Timer // fires when a query doesn't receive the answer in time
+	CacheKey                   string      // key of this subscription in the warm start cache (empty when not cached)
+	PendingRetransmissions     int         // messages sent by the retransmitter not processed by the writer yet (client can't reuse the id)
+	Held                       bool        // held by the policy, it was not validated, charged, timed or sent to Hasura yet
 }
 
 type BrowserConnection struct {
@@ -61,17 +68,28 @@ type BrowserConnection struct {
 	GraphqlActionsContextCancel        context.CancelFunc             // function to cancel the graphql actions context
 	FromBrowserToHasuraChannel         *SafeChannelByte               // channel to transmit messages from Browser to Hasura
 	FromBrowserToHasuraRateLimiter     *rate.Limiter                  // rate limiter to transmit messages from Browser to Hasura
+	QueryCostBudgetLimiter             *rate.Limiter                  // budget of query cost per minute (nil when disabled)
 	FromBrowserToGqlActionsChannel     *SafeChannelByte               // channel to transmit messages from Browser to Graphq-Actions
 	FromBrowserToGqlActionsRateLimiter *rate.Limiter                  // rate limiter to transmit messages from Browser to Graphq-Actions
+	MutationRateLimiters               map[string]*rate.Limiter       // rate limiters of the rules of mutation_rate_limits (by rule name)
 	FromHasuraToBrowserChannel         *SafeChannelByte               // channel to transmit messages from Hasura/GqlActions to Browser
 	LastBrowserMessageTime             time.Time                      // stores the time of the last message to control browser idleness
 	Logger                             *logrus.Entry                  // connection logger populated with connection info
 }
 
+// Upstream is the connection between the middleware and the GraphQL engine (Hasura)
+// Implementations are in the package hasura/upstream (websocket with Hasura and an in-memory fake engine)
+type Upstream interface {
+	Dial(ctx context.Context, cookies []*http.Cookie) error             // connects to the engine
+	Send(ctx context.Context, message []byte) error                     // sends a graphql-transport-ws message
+	Receive(ctx context.Context) (websocket.MessageType, []byte, error) // waits for the next message from the engine
+	Close(code websocket.StatusCode, reason string) error               // closes the connection
+}
+
 type HasuraConnection struct {
 	Id                  string                // hasura connection id
 	BrowserConn         *BrowserConnection    // browser connection that originated this hasura connection
-	Websocket           *websocket.Conn       // websocket used to connect to Hasura
+	Upstream            Upstream              // connection with Hasura (or the engine that replaces it)
 	WebsocketCloseError *websocket.CloseError // closeError received from Hasura
 	Context             context.Context       // hasura connection context (child of browser connection context)
 	ContextCancelFunc   context.CancelFunc    // function to cancel the hasura context (and so, the hasura connection)
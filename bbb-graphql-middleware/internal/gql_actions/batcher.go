@@ -0,0 +1,220 @@
+package gql_actions
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"bbb-graphql-middleware/config"
+	"bbb-graphql-middleware/internal/common"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+// Batches of actions sent to graphql-actions (batch_url) in a single request:
+//   request:  {"batch": [{"action": {"name": ...}, "input": {...}, "session_variables": {...}, "idempotency_key": ...}, ...]}
+//   response: [{"data": <result of the action>} or {"error": {"status": 400, "message": ..., "extensions": {...}}}, ...]
+// The results must be in the same order of the batch (graphql-actions executes them one after the other)
+
+var (
+	graphqlActionsBatchUrl = config.GetConfig().GraphqlActions.BatchUrl
+	actionBatchers         = make(map[string]*actionBatcher)
+)
+
+type batchedAction struct {
+	ctx    context.Context
+	body   batchedActionRequestBody
+	result chan batchedActionResult
+}
+
+type batchedActionRequestBody struct {
+	GqlActionsRequestBody
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+}
+
+type batchedActionResult struct {
+	data interface{}
+	err  error
+}
+
+type actionBatcher struct {
+	sync.Mutex
+	actionName string
+	maxSize    int
+	maxWait    time.Duration
+	pending    []*batchedAction
+	timer      *time.Timer
+}
+
+func init() {
+	for actionName, batching := range config.GetConfig().GraphqlActions.BatchedActions {
+		if batching.MaxSize <= 1 || batching.MaxWaitMs <= 0 {
+			continue
+		}
+
+		actionBatchers[actionName] = &actionBatcher{
+			actionName: actionName,
+			maxSize:    batching.MaxSize,
+			maxWait:    time.Duration(batching.MaxWaitMs) * time.Millisecond,
+		}
+		log.Infof("Action %s will be sent in batches (max %d actions, waiting %d ms)", actionName, batching.MaxSize, batching.MaxWaitMs)
+	}
+}
+
+func getActionBatcher(actionName string) *actionBatcher {
+	if graphqlActionsBatchUrl == "" {
+		return nil
+	}
+
+	return actionBatchers[actionName]
+}
+
+// send adds the action to the next batch and waits for its result
+func (b *actionBatcher) send(ctx context.Context, body GqlActionsRequestBody, idempotencyKey string) (interface{}, error) {
+	action := &batchedAction{
+		ctx:    ctx,
+		body:   batchedActionRequestBody{GqlActionsRequestBody: body, IdempotencyKey: idempotencyKey},
+		result: make(chan batchedActionResult, 1),
+	}
+
+	b.Lock()
+	b.pending = append(b.pending, action)
+	if len(b.pending) >= b.maxSize {
+		actions := b.takePending()
+		b.Unlock()
+		go b.flush(actions)
+	} else {
+		if b.timer == nil {
+			b.timer = time.AfterFunc(b.maxWait, b.flushPending)
+		}
+		b.Unlock()
+	}
+
+	select {
+	case result := <-action.result:
+		return result.data, result.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// takePending must be called holding the lock
+func (b *actionBatcher) takePending() []*batchedAction {
+	actions := b.pending
+	b.pending = nil
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+
+	return actions
+}
+
+func (b *actionBatcher) flushPending() {
+	b.Lock()
+	actions := b.takePending()
+	b.Unlock()
+
+	if len(actions) > 0 {
+		b.flush(actions)
+	}
+}
+
+func (b *actionBatcher) flush(actions []*batchedAction) {
+	// Actions already cancelled (e.g. the browser disconnected) are not sent
+	activeActions := make([]*batchedAction, 0, len(actions))
+	bodies := make([]batchedActionRequestBody, 0, len(actions))
+	for _, action := range actions {
+		if action.ctx.Err() == nil {
+			activeActions = append(activeActions, action)
+			bodies = append(bodies, action.body)
+		}
+	}
+	if len(activeActions) == 0 {
+		return
+	}
+
+	common.GqlActionsBatchSize.With(prometheus.Labels{"action": b.actionName}).Observe(float64(len(activeActions)))
+
+	results, err := sendGqlActionsBatchRequest(b.actionName, bodies)
+	for i, action := range activeActions {
+		if err != nil {
+			action.result <- batchedActionResult{err: err}
+			continue
+		}
+		action.result <- results[i]
+	}
+}
+
+func sendGqlActionsBatchRequest(actionName string, bodies []batchedActionRequestBody) ([]batchedActionResult, error) {
+	jsonData, err := json.Marshal(map[string]interface{}{"batch": bodies})
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequest(http.MethodPost, graphqlActionsBatchUrl, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	response, cancelRequest, err := doGqlActionsRequest(context.Background(), request, actionName)
+	if err != nil {
+		log.Errorf("Error sending batch of %d %s to graphql actions: %v", len(bodies), actionName, err)
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, err
+		}
+		return nil, &RequestError{ErrorId: common.ErrorIdUpstreamUnavailable, Err: err}
+	}
+	defer cancelRequest()
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, &RequestError{ErrorId: common.ErrorIdUpstreamUnavailable, Err: err}
+	}
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		var result map[string]interface{}
+		_ = json.Unmarshal(body, &result)
+		requestError := newActionError(response.StatusCode, result)
+		log.Errorf("Batch of %d %s failed: %v", len(bodies), actionName, requestError)
+		return nil, requestError
+	}
+
+	var batchResponse []struct {
+		Data  interface{} `json:"data"`
+		Error *struct {
+			Status     int                    `json:"status"`
+			Message    string                 `json:"message"`
+			Extensions map[string]interface{} `json:"extensions"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &batchResponse); err != nil || len(batchResponse) != len(bodies) {
+		return nil, &RequestError{
+			ErrorId: common.ErrorIdInternalError,
+			Err:     fmt.Errorf("invalid response for a batch of %d %s: %s", len(bodies), actionName, string(body)),
+		}
+	}
+
+	results := make([]batchedActionResult, 0, len(batchResponse))
+	for _, itemResponse := range batchResponse {
+		if itemResponse.Error != nil {
+			results = append(results, batchedActionResult{err: newActionError(itemResponse.Error.Status, map[string]interface{}{
+				"message":    itemResponse.Error.Message,
+				"extensions": itemResponse.Error.Extensions,
+			})})
+			continue
+		}
+		results = append(results, batchedActionResult{data: itemResponse.Data})
+	}
+
+	return results, nil
+}
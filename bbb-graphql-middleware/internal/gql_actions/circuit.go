@@ -0,0 +1,110 @@
+package gql_actions
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"bbb-graphql-middleware/config"
+	"bbb-graphql-middleware/internal/common"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Circuit breaker of graphql-actions: after some consecutive failures (it can't be reached or answers 502, 503 or 504)
+// the requests fail right away, until a request is allowed again (one at a time) after circuit_breaker_open_seconds
+
+var (
+	circuitBreakerFailures     = config.GetConfig().GraphqlActions.CircuitBreakerFailures
+	circuitBreakerOpenDuration = time.Duration(config.GetConfig().GraphqlActions.CircuitBreakerOpenSeconds) * time.Second
+	graphqlActionsCircuit      = &circuitBreaker{}
+	errCircuitOpen             = errors.New("graphql actions circuit is open")
+)
+
+type circuitBreaker struct {
+	sync.Mutex
+	failures      int
+	open          bool
+	openedAt      time.Time
+	probeSentAt   time.Time
+	onCloseNotify []func()
+}
+
+// allow returns false while the circuit is open, except for the request that will check if graphql-actions is back
+func (c *circuitBreaker) allow() bool {
+	if circuitBreakerFailures <= 0 {
+		return true
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	if !c.open {
+		return true
+	}
+
+	if time.Since(c.openedAt) < circuitBreakerOpenDuration || time.Since(c.probeSentAt) < circuitBreakerOpenDuration {
+		return false
+	}
+
+	c.probeSentAt = time.Now()
+	return true
+}
+
+// isClosing returns true when the circuit is closed or a request would be allowed (without taking the probe)
+func (c *circuitBreaker) isClosing() bool {
+	if circuitBreakerFailures <= 0 {
+		return true
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	return !c.open || (time.Since(c.openedAt) >= circuitBreakerOpenDuration && time.Since(c.probeSentAt) >= circuitBreakerOpenDuration)
+}
+
+func (c *circuitBreaker) recordResult(statusCode int, err error) {
+	if circuitBreakerFailures <= 0 {
+		return
+	}
+
+	failed := err != nil || statusCode == http.StatusBadGateway || statusCode == http.StatusServiceUnavailable || statusCode == http.StatusGatewayTimeout
+
+	c.Lock()
+	if !failed {
+		wasOpen := c.open
+		c.failures = 0
+		c.open = false
+		onCloseNotify := c.onCloseNotify
+		c.Unlock()
+
+		if wasOpen {
+			log.Infof("Graphql actions is available again, circuit closed")
+			common.GqlActionsCircuitOpenGauge.Set(0)
+			for _, notify := range onCloseNotify {
+				notify()
+			}
+		}
+		return
+	}
+
+	c.failures++
+	if !c.open && c.failures >= circuitBreakerFailures {
+		log.Warnf("Graphql actions failed %d times in a row, circuit opened for %v", c.failures, circuitBreakerOpenDuration)
+		c.open = true
+		common.GqlActionsCircuitOpenGauge.Set(1)
+	}
+	if c.open {
+		c.openedAt = time.Now()
+	}
+	c.Unlock()
+}
+
+// onClose registers a function called when the circuit is closed
+func (c *circuitBreaker) onClose(notify func()) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.onCloseNotify = append(c.onCloseNotify, notify)
+}
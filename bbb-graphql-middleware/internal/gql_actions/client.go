@@ -4,15 +4,17 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"maps"
 	"net/http"
-	"regexp"
-	"strings"
 	"time"
 
 	"bbb-graphql-middleware/config"
+	"bbb-graphql-middleware/internal/audit"
 	"bbb-graphql-middleware/internal/common"
+	"bbb-graphql-middleware/internal/policy"
 
 	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
@@ -26,6 +28,9 @@ func GraphqlActionsClient(
 	browserConnection.Logger.Debug("Starting GraphqlActionsClient")
 	defer browserConnection.Logger.Debug("Finished GraphqlActionsClient")
 
+	dispatcher := newMutationDispatcher()
+	defer dispatcher.Wait()
+
 RangeLoop:
 	for {
 		select {
@@ -48,70 +53,79 @@ RangeLoop:
 				}
 
 				if browserMessage.Type == "subscribe" {
-					var mutationFuncName string
-
 					if config.GetConfig().Server.MaxMutationLength > 0 {
 						mutationLength := len(browserMessage.Payload.Query)
 						if mutationLength > config.GetConfig().Server.MaxMutationLength {
-							sendErrorMessage(
+							common.AddAbuseScore(browserConnection, common.AbuseReasonOversizedPayload)
+							common.SendErrorMessage(
 								browserConnection,
 								browserMessage.ID,
+								common.ErrorIdLimitExceeded,
 								fmt.Sprintf(
 									"Mutation %s is not valid with length %d and the max allowed is %d",
 									browserMessage.Payload.OperationName,
 									mutationLength, config.GetConfig().Server.MaxMutationLength))
+							auditRejectedMutation(browserConnection, browserMessage, nil, common.ErrorIdLimitExceeded)
 							continue
 						}
 					}
 
-					// Rate limiter from config max_connection_mutations_per_minute
-					ctxRateLimiter, _ := context.WithTimeout(browserConnection.Context, 30*time.Second)
-					if err := browserConnection.FromBrowserToGqlActionsRateLimiter.Wait(ctxRateLimiter); err != nil {
-						sendErrorMessage(
+					// Only mutations with at least one action are executed (otherwise the browser would receive empty data)
+					var actions []MutationAction
+					operationInfo, err := common.GetOperationInfo(browserMessage.Payload.Query, browserMessage.Payload.OperationName)
+					if err == nil && operationInfo.Type == common.Mutation {
+						actions, err = parseGraphQLMutation(operationInfo, browserMessage.Payload.Variables)
+					}
+					if err != nil || len(actions) == 0 {
+						browserConnection.Logger.Errorf("It was not able to parse graphQL mutation %s: %v", browserMessage.Payload.OperationName, err)
+						common.AddAbuseScore(browserConnection, common.AbuseReasonRejectedQuery)
+						common.SendErrorMessage(browserConnection, browserMessage.ID, common.ErrorIdValidationFailed, common.GetErrorMessage(common.ErrorIdValidationFailed))
+						auditRejectedMutation(browserConnection, browserMessage, nil, common.ErrorIdValidationFailed)
+						continue
+					}
+
+					// Check the operation policy of the role (and other session variables) for every action of the mutation
+					// The operationName is chosen by the client, so the root fields are the ones evaluated
+					if deniedAction, policyDecision := evaluateMutationPolicy(browserConnection, actions); !policyDecision.Allowed {
+						common.AddAbuseScore(browserConnection, common.AbuseReasonRejectedQuery)
+						common.SendErrorMessage(
 							browserConnection,
 							browserMessage.ID,
-							fmt.Sprintf("Rate limit exceeded: Maximum %d mutations per minute allowed. Please try again later.", config.GetConfig().Server.MaxConnectionMutationsPerMinute),
-						)
+							common.ErrorIdPermissionDenied,
+							fmt.Sprintf("Mutation %s is not allowed by the policy rule %s", deniedAction, policyDecision.Rule))
+						auditRejectedMutation(browserConnection, browserMessage, actions, common.ErrorIdPermissionDenied)
+						continue
+					}
 
+					// Rate limits of the actions (mutation_rate_limits), rejected right away so other actions are not held
+					actionNames := make([]string, 0, len(actions))
+					for _, action := range actions {
+						actionNames = append(actionNames, action.Name)
+					}
+					actionsByRule, actionsWithoutRule := common.GetMutationRateLimitRules(actionNames)
+					if exceededRule := common.AllowMutationRateLimits(browserConnection, actionsByRule); exceededRule != "" {
+						sendRateLimitedError(browserConnection, browserMessage, actions, exceededRule)
 						continue
 					}
 
-					if strings.HasPrefix(browserMessage.Payload.Query, "mutation") {
-						if funcName, inputs, err := parseGraphQLMutation(browserMessage.Payload.Query, browserMessage.Payload.Variables); err == nil {
-							mutationFuncName = funcName
-							if err = SendGqlActionsRequest(funcName, inputs, browserConnection.BBBWebSessionVariables, browserConnection.Logger); err == nil {
-								// Add Prometheus Metrics
-								common.GqlMutationsCounter.With(prometheus.Labels{"operationName": browserMessage.Payload.OperationName}).Inc()
-							} else {
-								sendErrorMessage(browserConnection, browserMessage.ID, fmt.Sprintf("It was not able to send the request to Graphql Actions: %s", err.Error()))
-								continue
-							}
-						} else {
-							sendErrorMessage(browserConnection, browserMessage.ID, fmt.Sprintf("It was not able to parse graphQL query: %s", err.Error()))
+					// Rate limiter from config max_connection_mutations_per_minute (for actions without a rule)
+					if actionsWithoutRule > 0 {
+						ctxRateLimiter, cancelRateLimiter := context.WithTimeout(browserConnection.Context, 30*time.Second)
+						err := browserConnection.FromBrowserToGqlActionsRateLimiter.WaitN(ctxRateLimiter, actionsWithoutRule)
+						cancelRateLimiter()
+						if err != nil {
+							sendRateLimitedError(browserConnection, browserMessage, actions, common.DefaultMutationRateLimitRule)
 							continue
 						}
 					}
 
-					// Action sent successfully, return data msg to client
-					browserResponseData := map[string]interface{}{
-						"id":   browserMessage.ID,
-						"type": "next",
-						"payload": map[string]interface{}{
-							"data": map[string]interface{}{
-								mutationFuncName: true,
-							},
-						},
-					}
-					jsonDataNext, _ := json.Marshal(browserResponseData)
-					browserConnection.FromHasuraToBrowserChannel.SendWait(browserConnection.Context, jsonDataNext)
+					browserConnection.RLock()
+					sessionVariables := browserConnection.BBBWebSessionVariables
+					browserConnection.RUnlock()
 
-					// Return complete msg to client
-					browserResponseComplete := map[string]interface{}{
-						"id":   browserMessage.ID,
-						"type": "complete",
-					}
-					jsonDataComplete, _ := json.Marshal(browserResponseComplete)
-					browserConnection.FromHasuraToBrowserChannel.SendWait(browserConnection.Context, jsonDataComplete)
+					dispatcher.Dispatch(browserConnection.GraphqlActionsContext, getOrderingKey(actions, browserMessage.Payload.OperationName), func() {
+						executeMutation(browserConnection, browserMessage, actions, sessionVariables)
+					})
 				}
 
 				// Fallback to Hasura was disabled (keeping the code temporarily)
@@ -123,7 +137,244 @@ RangeLoop:
 	return nil
 }
 
-func SendGqlActionsRequest(funcName string, inputs map[string]interface{}, sessionVariables map[string]string, bcLogger *log.Entry) error {
+// evaluateMutationPolicy returns the first action denied by the policy (the whole mutation is rejected)
+func evaluateMutationPolicy(browserConnection *common.BrowserConnection, actions []MutationAction) (string, policy.Decision) {
+	browserConnection.RLock()
+	defer browserConnection.RUnlock()
+
+	for _, action := range actions {
+		if policyDecision := policy.Evaluate(browserConnection.BBBWebSessionVariables, common.Mutation, action.Name); !policyDecision.Allowed {
+			return action.Name, policyDecision
+		}
+	}
+
+	return "", policy.Decision{Allowed: true}
+}
+
+func sendRateLimitedError(browserConnection *common.BrowserConnection, browserMessage common.BrowserSubscribeMessage, actions []MutationAction, ruleName string) {
+	common.GqlMutationRateLimitedCounter.With(prometheus.Labels{"rule": ruleName}).Inc()
+	common.AddAbuseScore(browserConnection, common.AbuseReasonRateLimited)
+	common.SendErrorMessage(
+		browserConnection,
+		browserMessage.ID,
+		common.ErrorIdRateLimited,
+		common.GetMutationRateLimitMessage(ruleName),
+	)
+	auditRejectedMutation(browserConnection, browserMessage, actions, common.ErrorIdRateLimited)
+}
+
+// auditRejectedMutation records the actions of a mutation rejected before being sent, with the error code as outcome
+// Mutations that couldn't be parsed are recorded without action
+func auditRejectedMutation(browserConnection *common.BrowserConnection, browserMessage common.BrowserSubscribeMessage, actions []MutationAction, errorId string) {
+	if !audit.IsEnabled() {
+		return
+	}
+
+	browserConnection.RLock()
+	sessionVariables := browserConnection.BBBWebSessionVariables
+	browserConnection.RUnlock()
+
+	if len(actions) == 0 {
+		audit.RecordAction(sessionVariables, browserMessage.Payload.OperationName, "", nil, errorId, 0)
+		return
+	}
+	for _, action := range actions {
+		audit.RecordAction(sessionVariables, browserMessage.Payload.OperationName, action.Name, action.Input, errorId, 0)
+	}
+}
+
+// executeMutation sends the actions of the mutation to graphql-actions and answers the browser
+// Mutations of outbox_actions wait in the outbox when graphql-actions is unavailable
+func executeMutation(browserConnection *common.BrowserConnection, browserMessage common.BrowserSubscribeMessage, actions []MutationAction, sessionVariables map[string]string) {
+	isOutboxMutation := isOutboxMutation(actions)
+	if isOutboxMutation && mutationOutbox.hasPending(browserConnection) {
+		// Keep the order with the mutations of this connection already waiting in the outbox
+		if !mutationOutbox.add(browserConnection, browserMessage, actions, sessionVariables) {
+			common.SendErrorMessage(browserConnection, browserMessage.ID, common.ErrorIdUpstreamUnavailable, common.GetErrorMessage(common.ErrorIdUpstreamUnavailable))
+		}
+		return
+	}
+
+	timeout := common.GetOperationTimeout(common.Mutation, browserMessage.Payload.OperationName)
+	responseData, failedAction, latencies, err := sendMutationActions(browserConnection.GraphqlActionsContext, browserConnection, browserMessage, actions, sessionVariables, timeout)
+	if err != nil && isOutboxMutation && isTransientError(err) && mutationOutbox.add(browserConnection, browserMessage, actions, sessionVariables) {
+		// It will be audited once it's sent from the outbox
+		return
+	}
+
+	auditMutation(browserMessage, actions, sessionVariables, latencies, err)
+	respondMutation(browserConnection, browserMessage, actions, responseData, failedAction, err, timeout)
+}
+
+// sendMutationActions sends each root field of the mutation as its own action, returning the data of the response
+// and the latency of each action sent (to be audited by the caller, only for the final attempt)
+// When an action fails, it returns the error and the action
+func sendMutationActions(
+	ctx context.Context,
+	browserConnection *common.BrowserConnection,
+	browserMessage common.BrowserSubscribeMessage,
+	actions []MutationAction,
+	sessionVariables map[string]string,
+	timeout time.Duration,
+) (map[string]interface{}, MutationAction, []time.Duration, error) {
+	responseData := make(map[string]interface{})
+	latencies := make([]time.Duration, 0, len(actions))
+	var err error
+
+	// Mutations must be answered in time, otherwise the client will receive an error
+	var ctxMutation context.Context
+	var cancelMutation context.CancelFunc
+	if timeout > 0 {
+		ctxMutation, cancelMutation = context.WithTimeout(ctx, timeout)
+	} else {
+		ctxMutation, cancelMutation = context.WithCancel(ctx)
+	}
+	defer cancelMutation()
+
+	browserConnection.RLock()
+	clientSessionUUID := browserConnection.ClientSessionUUID
+	browserConnection.RUnlock()
+
+	// Each root field is sent as its own action, in order (root fields of mutations are executed serially)
+	var failedAction MutationAction
+	for _, action := range actions {
+		// Only the actions that can be sent again (retryable_actions, outbox_actions) need a key, so graphql-actions doesn't keep the others
+		idempotencyKey := ""
+		if retryableActions[action.Name] || outboxActions[action.Name] {
+			idempotencyKey = fmt.Sprintf("%s:%s:%s", clientSessionUUID, browserMessage.ID, action.ResponseKey)
+		}
+
+		var actionResult interface{}
+		startedAt := time.Now()
+		actionResult, err = SendGqlActionsRequest(ctxMutation, action.Name, action.Input, sessionVariables, idempotencyKey, browserConnection.Logger)
+		latencies = append(latencies, time.Since(startedAt))
+		if err != nil {
+			failedAction = action
+			break
+		}
+		responseData[action.ResponseKey] = action.BuildResponse(actionResult)
+	}
+
+	return responseData, failedAction, latencies, err
+}
+
+// auditMutation records the actions sent (the last one failed when err is set)
+func auditMutation(browserMessage common.BrowserSubscribeMessage, actions []MutationAction, sessionVariables map[string]string, latencies []time.Duration, err error) {
+	for i, latency := range latencies {
+		outcome := getActionOutcome(nil)
+		if i == len(latencies)-1 {
+			outcome = getActionOutcome(err)
+		}
+		audit.RecordAction(sessionVariables, browserMessage.Payload.OperationName, actions[i].Name, actions[i].Input, outcome, latency)
+	}
+}
+
+// getActionOutcome returns the outcome of the action for the audit: success or the code of the error
+func getActionOutcome(err error) string {
+	if err == nil {
+		return "success"
+	}
+	if errors.Is(err, context.Canceled) {
+		return "cancelled"
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return common.ErrorIdOperationTimeout
+	}
+
+	var requestError *RequestError
+	if errors.As(err, &requestError) {
+		return requestError.ErrorId
+	}
+
+	return common.ErrorIdInternalError
+}
+
+// respondMutation sends the result of the mutation (or its error) to the browser
+// When an action of a mutation with many fields fails, the ones completed are sent as data (the others as null) with the error
+func respondMutation(
+	browserConnection *common.BrowserConnection,
+	browserMessage common.BrowserSubscribeMessage,
+	actions []MutationAction,
+	responseData map[string]interface{},
+	failedAction MutationAction,
+	err error,
+	timeout time.Duration,
+) {
+	var errorPayload []interface{}
+	if err == nil {
+		// Add Prometheus Metrics
+		common.GqlMutationsCounter.With(prometheus.Labels{"operationName": browserMessage.Payload.OperationName}).Inc()
+	} else if errors.Is(err, context.Canceled) {
+		browserConnection.Logger.Debugf("Mutation %s cancelled as the connection is gone", browserMessage.Payload.OperationName)
+		return
+	} else if errors.Is(err, context.DeadlineExceeded) {
+		common.GqlOperationTimeoutCounter.With(prometheus.Labels{
+			"type":          string(common.Mutation),
+			"operationName": browserMessage.Payload.OperationName,
+		}).Inc()
+		errorMessage := fmt.Sprintf("Mutation %s timed out after %v without response", browserMessage.Payload.OperationName, timeout)
+		browserConnection.Logger.Error(errorMessage)
+		errorPayload = common.BuildErrorPayload(common.ErrorIdOperationTimeout, errorMessage)
+	} else {
+		browserConnection.Logger.Errorf("It was not able to send the request to Graphql Actions: %v", err)
+		errorId := common.ErrorIdInternalError
+		var requestError *RequestError
+		if errors.As(err, &requestError) {
+			errorId = requestError.ErrorId
+		}
+		if requestError != nil && requestError.Message != "" {
+			// Errors returned by the action itself are forwarded (with their extensions)
+			errorPayload = requestError.BuildErrorPayload(failedAction.ResponseKey)
+		} else {
+			errorPayload = common.BuildErrorPayload(errorId, common.GetErrorMessage(errorId))
+		}
+	}
+
+	if errorPayload != nil && len(actions) <= 1 {
+		common.SendErrorPayload(browserConnection, browserMessage.ID, errorPayload)
+		return
+	}
+
+	payload := map[string]interface{}{
+		"data": responseData,
+	}
+	if errorPayload != nil {
+		// The failed action and the next ones (not executed) are null, the error points to the failed one
+		for _, action := range actions {
+			if _, completed := responseData[action.ResponseKey]; !completed {
+				responseData[action.ResponseKey] = nil
+			}
+		}
+		for _, errorItem := range errorPayload {
+			if errorMap, ok := errorItem.(map[string]interface{}); ok {
+				errorMap["path"] = []string{failedAction.ResponseKey}
+			}
+		}
+		payload["errors"] = errorPayload
+	}
+
+	// Return data msg to client
+	browserResponseData := map[string]interface{}{
+		"id":      browserMessage.ID,
+		"type":    "next",
+		"payload": payload,
+	}
+	jsonDataNext, _ := json.Marshal(browserResponseData)
+	browserConnection.FromHasuraToBrowserChannel.SendWait(browserConnection.Context, jsonDataNext)
+
+	// Return complete msg to client
+	browserResponseComplete := map[string]interface{}{
+		"id":   browserMessage.ID,
+		"type": "complete",
+	}
+	jsonDataComplete, _ := json.Marshal(browserResponseComplete)
+	browserConnection.FromHasuraToBrowserChannel.SendWait(browserConnection.Context, jsonDataComplete)
+}
+
+// SendGqlActionsRequest executes the action and returns its result (nil when the action returns nothing)
+// idempotencyKey identifies the action, so graphql-actions can ignore it when it's received again (retries)
+// It's empty for the actions that are never sent again
+func SendGqlActionsRequest(ctx context.Context, funcName string, inputs map[string]interface{}, sessionVariables map[string]string, idempotencyKey string, bcLogger *log.Entry) (interface{}, error) {
 	logger := bcLogger.WithField("funcName", funcName).WithField("inputs", inputs)
 
 	data := GqlActionsRequestBody{
@@ -140,26 +391,70 @@ func SendGqlActionsRequest(funcName string, inputs map[string]interface{}, sessi
 			userId := sessionVariables["x-hasura-userid"]
 			logger.Infof("Received %s meetingId=%s userId=%s", traceLog, meetingId, userId)
 
+			// The input of the action is kept as received (it's sent again by the outbox and audited)
 			now := time.Now().UTC()
+			data.Input = maps.Clone(inputs)
 			data.Input["traceLog"] = fmt.Sprintf("%s@gqlmiddleware|%s", traceLog, now.Format("2006-01-02T15:04:05.000Z"))
 		}
 	}
 
+	for attempt := 1; ; attempt++ {
+		result, err := sendGqlActionsRequestAttempt(ctx, data, idempotencyKey, logger)
+		if err == nil || !shouldRetryGqlActionsRequest(funcName, attempt, err) {
+			return result, err
+		}
+
+		backoff := getRetryBackoff(attempt)
+		logger.Warnf("Graphql actions request failed (attempt %d of %d), retrying in %v: %v", attempt, retryMaxAttempts, backoff, err)
+		common.GqlActionsRetriesCounter.With(prometheus.Labels{"action": getActionLabel(funcName, 0)}).Inc()
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func sendGqlActionsRequestAttempt(ctx context.Context, data GqlActionsRequestBody, idempotencyKey string, logger *log.Entry) (interface{}, error) {
+	funcName := data.Action.Name
+
+	// High-frequency actions can be sent together with others (of any connection) in a single request
+	if batcher := getActionBatcher(funcName); batcher != nil {
+		return batcher.send(ctx, data, idempotencyKey)
+	}
+
 	jsonData, err := json.Marshal(data)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if graphqlActionsUrl == "" {
-		return fmt.Errorf("No Graphql Actions Url (BBB_GRAPHQL_MIDDLEWARE_GRAPHQL_ACTIONS_URL) set, aborting")
+		return nil, &RequestError{
+			ErrorId: common.ErrorIdInternalError,
+			Err:     fmt.Errorf("No Graphql Actions Url (BBB_GRAPHQL_MIDDLEWARE_GRAPHQL_ACTIONS_URL) set, aborting"),
+		}
 	}
 
 	startedAt := time.Now()
 
-	response, err := http.Post(graphqlActionsUrl, "application/json", bytes.NewBuffer(jsonData))
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, graphqlActionsUrl, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return err
+		return nil, err
 	}
+	request.Header.Set("Content-Type", "application/json")
+	if idempotencyKey != "" {
+		request.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	response, cancelRequest, err := doGqlActionsRequest(ctx, request, funcName)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+			return nil, err
+		}
+		return nil, &RequestError{ErrorId: common.ErrorIdUpstreamUnavailable, Err: err}
+	}
+	defer cancelRequest()
 	defer response.Body.Close()
 
 	totalDurationMillis := time.Since(startedAt).Milliseconds()
@@ -170,101 +465,99 @@ func SendGqlActionsRequest(funcName string, inputs map[string]interface{}, sessi
 		logger.Infof("Took too long to execute!")
 	}
 
-	if response.StatusCode != 200 {
-		body, err := ioutil.ReadAll(response.Body)
-		if err != nil {
-			fmt.Println("Error reading response body:", err)
-		}
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		logger.Errorf("Error reading response body: %v", err)
+	}
 
+	if response.StatusCode < 200 || response.StatusCode > 299 {
 		var result map[string]interface{}
-		err = json.Unmarshal(body, &result)
-		if err == nil {
-			if message, ok := result["message"].(string); ok {
-				logger.Errorf(string(jsonData), message, err)
-				return fmt.Errorf("graphql actions request failed: %s", message)
-			}
+		_ = json.Unmarshal(body, &result)
+		if message, ok := result["message"].(string); ok {
+			logger.Errorf("%s: %s", string(jsonData), message)
 		}
 
-		return fmt.Errorf("graphql actions request failed: %s", response.Status)
+		return nil, newActionError(response.StatusCode, result)
 	}
 
-	return nil
-}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, nil
+	}
 
-type GqlActionsRequestBody struct {
-	Action           GqlActionsAction       `json:"action"`
-	Input            map[string]interface{} `json:"input"`
-	SessionVariables map[string]string      `json:"session_variables"`
-}
+	var result interface{}
+	if err := json.Unmarshal(body, &result); err != nil {
+		logger.Warnf("Response of graphql actions is not a valid json: %v", err)
+		return nil, nil
+	}
 
-type GqlActionsAction struct {
-	Name string `json:"name"`
+	return result, nil
 }
 
-func parseGraphQLMutation(query string, variables map[string]interface{}) (string, map[string]interface{}, error) {
-	// Extract the function name from the query
-	reFuncName := regexp.MustCompile(`\{\s*(\w+)`)
-	funcNameMatch := reFuncName.FindStringSubmatch(query)
-	if len(funcNameMatch) < 2 {
-		return "", nil, fmt.Errorf("failed to extract function name from query")
-	}
-	funcName := funcNameMatch[1]
-
-	// Prepare to extract and parse parameters
-	queryParams := make(map[string]interface{})
-	reParams := regexp.MustCompile(`\{[^(]+\(([^)]+)\)`)
-	paramsMatch := reParams.FindStringSubmatch(query)
-	if len(paramsMatch) >= 2 {
-		paramSplitRegex := regexp.MustCompile("[,\n]")
-		params := paramSplitRegex.Split(paramsMatch[1], -1)
-
-		for _, param := range params {
-			cleanedParam := strings.ReplaceAll(param, " ", "")
-			if cleanedParam == "" {
-				continue
-			}
-			paramParts := strings.Split(cleanedParam, ":")
-			if len(paramParts) != 2 {
-				continue // Skip invalid params
-			}
-			paramName, paramValue := strings.Trim(paramParts[0], " \t"), paramParts[1]
+// newActionError returns the error of an action from the status and the body ({message, extensions}) returned by graphql-actions
+func newActionError(statusCode int, result map[string]interface{}) *RequestError {
+	requestError := &RequestError{
+		ErrorId:    common.GetErrorIdFromHttpStatus(statusCode),
+		Err:        fmt.Errorf("graphql actions request failed: %d %s", statusCode, http.StatusText(statusCode)),
+		StatusCode: statusCode,
+	}
 
-			// Handle variable substitution
-			if strings.HasPrefix(paramValue, "$") {
-				varName := strings.TrimPrefix(paramValue, "$")
-				if value, ok := variables[varName]; ok {
-					queryParams[paramName] = value
-				}
-			} else {
-				queryParams[paramName] = paramValue
-			}
+	if message, ok := result["message"].(string); ok {
+		requestError.Err = fmt.Errorf("graphql actions request failed: %s", message)
+
+		// Errors of the client (4xx) were produced by the action itself and can be shown to the user
+		if statusCode < 500 {
+			requestError.Message = message
+			requestError.Extensions, _ = result["extensions"].(map[string]interface{})
 		}
 	}
 
-	return funcName, queryParams, nil
+	return requestError
 }
 
-func sendErrorMessage(browserConnection *common.BrowserConnection, messageId string, errorMessage string) {
-	browserConnection.Logger.Errorf(errorMessage)
+// RequestError is returned when a request to graphql-actions fails
+// ErrorId is the code that will be sent to the browser, Err keeps the details (only for logging)
+// StatusCode is the status returned by graphql-actions (0 when it was not reached)
+// Message and Extensions are set when the action returned an error that can be forwarded to the browser
+type RequestError struct {
+	ErrorId    string
+	Err        error
+	StatusCode int
+	Message    string
+	Extensions map[string]interface{}
+}
 
-	// Error on sending action, return error msg to client
-	browserResponseData := map[string]interface{}{
-		"id":   messageId,
-		"type": "error",
-		"payload": []interface{}{
-			map[string]interface{}{
-				"message": errorMessage,
-			},
+func (e *RequestError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// BuildErrorPayload returns the error of the action as a GraphQL error (keeping the code of the middleware)
+func (e *RequestError) BuildErrorPayload(responseKey string) []interface{} {
+	extensions := make(map[string]interface{})
+	for key, value := range e.Extensions {
+		extensions[key] = value
+	}
+	extensions["code"] = e.ErrorId
+
+	return []interface{}{
+		map[string]interface{}{
+			"message":    e.Message,
+			"messageId":  e.ErrorId,
+			"path":       []string{responseKey},
+			"extensions": extensions,
 		},
 	}
-	jsonDataError, _ := json.Marshal(browserResponseData)
-	browserConnection.FromHasuraToBrowserChannel.SendWait(browserConnection.Context, jsonDataError)
+}
 
-	// Return complete msg to client
-	browserResponseComplete := map[string]interface{}{
-		"id":   messageId,
-		"type": "complete",
-	}
-	jsonDataComplete, _ := json.Marshal(browserResponseComplete)
-	browserConnection.FromHasuraToBrowserChannel.SendWait(browserConnection.Context, jsonDataComplete)
+type GqlActionsRequestBody struct {
+	Action           GqlActionsAction       `json:"action"`
+	Input            map[string]interface{} `json:"input"`
+	SessionVariables map[string]string      `json:"session_variables"`
+}
+
+type GqlActionsAction struct {
+	Name string `json:"name"`
 }
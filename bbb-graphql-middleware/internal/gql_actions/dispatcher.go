@@ -0,0 +1,90 @@
+package gql_actions
+
+import (
+	"context"
+	"sync"
+
+	"bbb-graphql-middleware/config"
+)
+
+// Mutations of a connection run concurrently (up to max_connection_concurrent_mutations),
+// except the ones with the same ordering key, that run one after the other in the order they were received
+
+var (
+	maxConcurrentMutations = max(config.GetConfig().Server.MaxConnectionConcurrentMutations, 1)
+	mutationOrderingKeys   = config.GetConfig().Server.MutationOrderingKeys
+)
+
+type mutationDispatcher struct {
+	sync.Mutex
+	slots     chan struct{}
+	lastByKey map[string]chan struct{} // done channel of the last mutation dispatched with each key
+	wg        sync.WaitGroup
+}
+
+func newMutationDispatcher() *mutationDispatcher {
+	return &mutationDispatcher{
+		slots:     make(chan struct{}, maxConcurrentMutations),
+		lastByKey: make(map[string]chan struct{}),
+	}
+}
+
+// Dispatch runs the task after the previous one with the same key finishes (and there is a free slot)
+func (d *mutationDispatcher) Dispatch(ctx context.Context, orderingKey string, task func()) {
+	done := make(chan struct{})
+
+	d.Lock()
+	previous := d.lastByKey[orderingKey]
+	d.lastByKey[orderingKey] = done
+	d.Unlock()
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		defer func() {
+			close(done)
+			d.Lock()
+			if d.lastByKey[orderingKey] == done {
+				delete(d.lastByKey, orderingKey)
+			}
+			d.Unlock()
+		}()
+
+		// Wait for the previous one before taking a slot, so it never waits holding a slot
+		if previous != nil {
+			select {
+			case <-previous:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		select {
+		case d.slots <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		defer func() { <-d.slots }()
+
+		task()
+	}()
+}
+
+// Wait blocks until all the mutations dispatched are finished
+func (d *mutationDispatcher) Wait() {
+	d.wg.Wait()
+}
+
+// getOrderingKey returns the key of the first action of the mutation (the action name, unless it's configured)
+func getOrderingKey(actions []MutationAction, operationName string) string {
+	actionName := operationName
+	if len(actions) > 0 {
+		actionName = actions[0].Name
+	}
+
+	if orderingKey, exists := mutationOrderingKeys[actionName]; exists && orderingKey != "" {
+		return orderingKey
+	}
+
+	return actionName
+}
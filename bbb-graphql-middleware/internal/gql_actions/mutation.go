@@ -0,0 +1,261 @@
+package gql_actions
+
+import (
+	"fmt"
+	"strconv"
+
+	"bbb-graphql-middleware/internal/common"
+
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// MutationAction is a root field of the mutation, each one is sent to graphql-actions as its own action
+type MutationAction struct {
+	ResponseKey string                 // alias (or name) of the field, used as key of the data sent to the browser
+	Name        string                 // name of the action
+	Input       map[string]interface{} // arguments, with literals and variables coerced into json values
+
+	selectionSet *ast.SelectionSet // fields selected from the result of the action (when it returns an object)
+	fragments    map[string]*ast.FragmentDefinition
+}
+
+// BuildResponse returns the result of the action with the fields selected in the mutation (using their aliases)
+// Actions that return nothing are answered with `true`
+func (action MutationAction) BuildResponse(result interface{}) interface{} {
+	if result == nil {
+		return true
+	}
+
+	return selectResultFields(result, action.selectionSet, action.fragments, make(map[string]bool))
+}
+
+func selectResultFields(result interface{}, selectionSet *ast.SelectionSet, fragments map[string]*ast.FragmentDefinition, visitedFragments map[string]bool) interface{} {
+	if selectionSet == nil {
+		return result
+	}
+
+	switch value := result.(type) {
+	case []interface{}:
+		items := make([]interface{}, 0, len(value))
+		for _, item := range value {
+			items = append(items, selectResultFields(item, selectionSet, fragments, visitedFragments))
+		}
+		return items
+	case map[string]interface{}:
+		selected := make(map[string]interface{})
+		collectResultFields(selected, value, selectionSet, fragments, visitedFragments)
+		return selected
+	default:
+		return result
+	}
+}
+
+func collectResultFields(selected map[string]interface{}, object map[string]interface{}, selectionSet *ast.SelectionSet, fragments map[string]*ast.FragmentDefinition, visitedFragments map[string]bool) {
+	for _, selection := range selectionSet.Selections {
+		switch sel := selection.(type) {
+		case *ast.Field:
+			responseKey := sel.Name.Value
+			if sel.Alias != nil {
+				responseKey = sel.Alias.Value
+			}
+			fieldValue, exists := object[sel.Name.Value]
+			if !exists {
+				if sel.Name.Value == "__typename" {
+					continue
+				}
+				fieldValue = nil
+			}
+			selected[responseKey] = selectResultFields(fieldValue, sel.SelectionSet, fragments, visitedFragments)
+		case *ast.InlineFragment:
+			collectResultFields(selected, object, sel.SelectionSet, fragments, visitedFragments)
+		case *ast.FragmentSpread:
+			fragment, exists := fragments[sel.Name.Value]
+			if !exists || visitedFragments[sel.Name.Value] {
+				continue
+			}
+			visitedFragments[sel.Name.Value] = true
+			collectResultFields(selected, object, fragment.SelectionSet, fragments, visitedFragments)
+			delete(visitedFragments, sel.Name.Value)
+		}
+	}
+}
+
+// parseGraphQLMutation extracts the actions of the mutation (in the order they must be executed)
+func parseGraphQLMutation(operationInfo *common.OperationInfo, variables map[string]interface{}) ([]MutationAction, error) {
+	if operationInfo == nil || operationInfo.Operation == nil {
+		return nil, fmt.Errorf("mutation not found in the query")
+	}
+
+	mp := &mutationParser{
+		fragments:        common.GetFragmentDefinitions(operationInfo.Document),
+		variables:        variables,
+		variableDefaults: make(map[string]ast.Value),
+		visitedFragments: make(map[string]bool),
+	}
+	for _, variableDefinition := range operationInfo.Operation.VariableDefinitions {
+		if variableDefinition.DefaultValue != nil {
+			mp.variableDefaults[variableDefinition.Variable.Name.Value] = variableDefinition.DefaultValue
+		}
+	}
+
+	if err := mp.collectActions(operationInfo.Operation.SelectionSet); err != nil {
+		return nil, err
+	}
+	if len(mp.actions) == 0 {
+		return nil, fmt.Errorf("no mutation field found in the query")
+	}
+
+	return mp.actions, nil
+}
+
+type mutationParser struct {
+	fragments        map[string]*ast.FragmentDefinition
+	variables        map[string]interface{}
+	variableDefaults map[string]ast.Value
+	visitedFragments map[string]bool
+	actions          []MutationAction
+}
+
+func (mp *mutationParser) collectActions(selectionSet *ast.SelectionSet) error {
+	if selectionSet == nil {
+		return nil
+	}
+
+	for _, selection := range selectionSet.Selections {
+		switch sel := selection.(type) {
+		case *ast.Field:
+			if sel.Name.Value == "__typename" || !mp.isIncluded(sel.Directives) {
+				continue
+			}
+
+			action := MutationAction{
+				ResponseKey:  sel.Name.Value,
+				Name:         sel.Name.Value,
+				Input:        make(map[string]interface{}),
+				selectionSet: sel.SelectionSet,
+				fragments:    mp.fragments,
+			}
+			if sel.Alias != nil {
+				action.ResponseKey = sel.Alias.Value
+			}
+			for _, argument := range sel.Arguments {
+				value, provided, err := mp.coerceValue(argument.Value)
+				if err != nil {
+					return fmt.Errorf("argument %s of %s: %v", argument.Name.Value, sel.Name.Value, err)
+				}
+				if provided {
+					action.Input[argument.Name.Value] = value
+				}
+			}
+			mp.actions = append(mp.actions, action)
+		case *ast.InlineFragment:
+			if !mp.isIncluded(sel.Directives) {
+				continue
+			}
+			if err := mp.collectActions(sel.SelectionSet); err != nil {
+				return err
+			}
+		case *ast.FragmentSpread:
+			if !mp.isIncluded(sel.Directives) {
+				continue
+			}
+			fragment, exists := mp.fragments[sel.Name.Value]
+			if !exists {
+				return fmt.Errorf("unknown fragment %s", sel.Name.Value)
+			}
+			if mp.visitedFragments[sel.Name.Value] {
+				continue
+			}
+			mp.visitedFragments[sel.Name.Value] = true
+			if err := mp.collectActions(fragment.SelectionSet); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// isIncluded evaluates the directives @skip(if:) and @include(if:)
+func (mp *mutationParser) isIncluded(directives []*ast.Directive) bool {
+	for _, directive := range directives {
+		if directive.Name == nil || (directive.Name.Value != "skip" && directive.Name.Value != "include") {
+			continue
+		}
+		for _, argument := range directive.Arguments {
+			if argument.Name.Value != "if" {
+				continue
+			}
+			value, _, err := mp.coerceValue(argument.Value)
+			condition, isBool := value.(bool)
+			if err != nil || !isBool {
+				continue
+			}
+			if (directive.Name.Value == "skip" && condition) || (directive.Name.Value == "include" && !condition) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// coerceValue converts a literal (or variable) into its json value
+// It returns false when it's a variable that was not provided (and has no default value)
+func (mp *mutationParser) coerceValue(value ast.Value) (interface{}, bool, error) {
+	switch v := value.(type) {
+	case *ast.Variable:
+		if variableValue, provided := mp.variables[v.Name.Value]; provided {
+			return variableValue, true, nil
+		}
+		if defaultValue, exists := mp.variableDefaults[v.Name.Value]; exists {
+			return mp.coerceValue(defaultValue)
+		}
+		return nil, false, nil
+	case *ast.IntValue:
+		intValue, err := strconv.ParseInt(v.Value, 10, 64)
+		if err != nil {
+			return nil, false, err
+		}
+		return intValue, true, nil
+	case *ast.FloatValue:
+		floatValue, err := strconv.ParseFloat(v.Value, 64)
+		if err != nil {
+			return nil, false, err
+		}
+		return floatValue, true, nil
+	case *ast.StringValue:
+		return v.Value, true, nil
+	case *ast.BooleanValue:
+		return v.Value, true, nil
+	case *ast.EnumValue:
+		return v.Value, true, nil
+	case *ast.ListValue:
+		list := make([]interface{}, 0, len(v.Values))
+		for _, item := range v.Values {
+			itemValue, provided, err := mp.coerceValue(item)
+			if err != nil {
+				return nil, false, err
+			}
+			if !provided {
+				itemValue = nil
+			}
+			list = append(list, itemValue)
+		}
+		return list, true, nil
+	case *ast.ObjectValue:
+		object := make(map[string]interface{}, len(v.Fields))
+		for _, field := range v.Fields {
+			fieldValue, provided, err := mp.coerceValue(field.Value)
+			if err != nil {
+				return nil, false, err
+			}
+			if provided {
+				object[field.Name.Value] = fieldValue
+			}
+		}
+		return object, true, nil
+	default:
+		return nil, false, fmt.Errorf("unsupported value %T", value)
+	}
+}
@@ -0,0 +1,197 @@
+package gql_actions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	_ "bbb-graphql-middleware/config/configtest"
+	"bbb-graphql-middleware/internal/common"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestParseGraphQLMutation(t *testing.T) {
+	type expectedAction struct {
+		ResponseKey string
+		Name        string
+		Input       map[string]interface{}
+	}
+
+	tests := []struct {
+		name      string
+		query     string
+		variables map[string]interface{}
+		expected  []expectedAction
+		expectErr bool
+	}{
+		{
+			name:     "literals",
+			query:    `mutation m { userSetAway(away: true, count: 2, ratio: 0.5, role: MODERATOR, ids: ["a", "b"], obj: {x: "y"}) }`,
+			expected: []expectedAction{{"userSetAway", "userSetAway", map[string]interface{}{"away": true, "count": int64(2), "ratio": 0.5, "role": "MODERATOR", "ids": []interface{}{"a", "b"}, "obj": map[string]interface{}{"x": "y"}}}},
+		},
+		{
+			name:      "variables and defaults",
+			query:     `mutation m($text: String!, $format: String = "plain", $missing: String) { chatSendMessage(chatMessageInMarkdownFormat: $text, format: $format, extra: $missing) }`,
+			variables: map[string]interface{}{"text": "hello"},
+			expected:  []expectedAction{{"chatSendMessage", "chatSendMessage", map[string]interface{}{"chatMessageInMarkdownFormat": "hello", "format": "plain"}}},
+		},
+		{
+			name:  "aliases in order",
+			query: `mutation m { first: chatSendMessage(text: "1") second: chatSendMessage(text: "2") userSetAway(away: false) }`,
+			expected: []expectedAction{
+				{"first", "chatSendMessage", map[string]interface{}{"text": "1"}},
+				{"second", "chatSendMessage", map[string]interface{}{"text": "2"}},
+				{"userSetAway", "userSetAway", map[string]interface{}{"away": false}},
+			},
+		},
+		{
+			name:      "skip and include",
+			query:     `mutation m($skip: Boolean!) { a: userSetAway(away: true) @skip(if: $skip) b: userSetAway(away: false) @include(if: false) c: userSetAway(away: true) @include(if: true) }`,
+			variables: map[string]interface{}{"skip": true},
+			expected:  []expectedAction{{"c", "userSetAway", map[string]interface{}{"away": true}}},
+		},
+		{
+			name: "fragments and __typename",
+			query: `mutation m { __typename ...Actions ... on mutation_root { userSetAway(away: true) } }
+				fragment Actions on mutation_root { chatSendMessage(text: "hi") }`,
+			expected: []expectedAction{
+				{"chatSendMessage", "chatSendMessage", map[string]interface{}{"text": "hi"}},
+				{"userSetAway", "userSetAway", map[string]interface{}{"away": true}},
+			},
+		},
+		{
+			name:      "no actions",
+			query:     `mutation m { __typename }`,
+			expectErr: true,
+		},
+		{
+			name:      "unknown fragment",
+			query:     `mutation m { ...Missing }`,
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			operationInfo, err := common.GetOperationInfo(tt.query, "m")
+			if err != nil {
+				t.Fatalf("failed to parse query: %v", err)
+			}
+
+			actions, err := parseGraphQLMutation(operationInfo, tt.variables)
+			if tt.expectErr {
+				if err == nil {
+					t.Fatalf("expected error, got %d actions", len(actions))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			parsed := make([]expectedAction, 0, len(actions))
+			for _, action := range actions {
+				parsed = append(parsed, expectedAction{action.ResponseKey, action.Name, action.Input})
+			}
+			if !reflect.DeepEqual(parsed, tt.expected) {
+				t.Errorf("expected %+v, got %+v", tt.expected, parsed)
+			}
+		})
+	}
+}
+
+func TestRespondMutation(t *testing.T) {
+	operationInfo, _ := common.GetOperationInfo(`mutation m { a: chatSendMessage(text: "1") b: chatSendMessage(text: "2") c: userSetAway(away: true) }`, "m")
+	actions, _ := parseGraphQLMutation(operationInfo, nil)
+	actionError := &RequestError{ErrorId: common.ErrorIdValidationFailed, Message: "message too long"}
+
+	tests := []struct {
+		name         string
+		actions      []MutationAction
+		responseData map[string]interface{}
+		failedAction MutationAction
+		err          error
+		expected     []string // json of the messages sent to the browser
+	}{
+		{
+			name:         "completed",
+			actions:      actions,
+			responseData: map[string]interface{}{"a": true, "b": true, "c": true},
+			expected: []string{
+				`{"id":"1","payload":{"data":{"a":true,"b":true,"c":true}},"type":"next"}`,
+				`{"id":"1","type":"complete"}`,
+			},
+		},
+		{
+			name:         "partial data with the error path",
+			actions:      actions,
+			responseData: map[string]interface{}{"a": true},
+			failedAction: actions[1],
+			err:          actionError,
+			expected: []string{
+				`{"id":"1","payload":{"data":{"a":true,"b":null,"c":null},"errors":[{"extensions":{"code":"validation_failed"},"message":"message too long","messageId":"validation_failed","path":["b"]}]},"type":"next"}`,
+				`{"id":"1","type":"complete"}`,
+			},
+		},
+		{
+			name:         "single action error",
+			actions:      actions[:1],
+			responseData: map[string]interface{}{},
+			failedAction: actions[0],
+			err:          errors.New("connection refused"),
+			expected: []string{
+				`{"id":"1","payload":[{"extensions":{"code":"internal_error"},"message":"` + common.GetErrorMessage(common.ErrorIdInternalError) + `","messageId":"internal_error"}],"type":"error"}`,
+				`{"id":"1","type":"complete"}`,
+			},
+		},
+		{
+			name:         "cancelled",
+			actions:      actions,
+			responseData: map[string]interface{}{},
+			failedAction: actions[0],
+			err:          context.Canceled,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			browserConnection := &common.BrowserConnection{
+				Context:                    context.Background(),
+				FromHasuraToBrowserChannel: common.NewSafeChannelByte(10),
+				Logger:                     log.WithField("test", t.Name()),
+			}
+			var browserMessage common.BrowserSubscribeMessage
+			browserMessage.ID = "1"
+			browserMessage.Payload.OperationName = "m"
+
+			respondMutation(browserConnection, browserMessage, tt.actions, tt.responseData, tt.failedAction, tt.err, 0)
+
+			var sent []string
+			for len(browserConnection.FromHasuraToBrowserChannel.ReceiveChannel()) > 0 {
+				message, _ := browserConnection.FromHasuraToBrowserChannel.Receive()
+				sent = append(sent, normalizeJson(t, message))
+			}
+			for i := range tt.expected {
+				tt.expected[i] = normalizeJson(t, []byte(tt.expected[i]))
+			}
+			if !reflect.DeepEqual(sent, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, sent)
+			}
+		})
+	}
+}
+
+func normalizeJson(t *testing.T, message []byte) string {
+	t.Helper()
+
+	var value interface{}
+	if err := json.Unmarshal(message, &value); err != nil {
+		t.Fatalf("invalid json %s: %v", message, err)
+	}
+	normalized, _ := json.Marshal(value)
+
+	return string(normalized)
+}
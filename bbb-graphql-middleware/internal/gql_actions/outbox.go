@@ -0,0 +1,244 @@
+package gql_actions
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"bbb-graphql-middleware/config"
+	"bbb-graphql-middleware/internal/audit"
+	"bbb-graphql-middleware/internal/common"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Outbox of important mutations (outbox_actions) while graphql-actions is unavailable:
+// they wait in memory (bounded per connection and in total) and are sent in the order each connection sent them
+// when the circuit closes. The browser receives a `pong` telling the mutation is pending.
+// Each connection has its own queue, replayed by its own routine (a slow browser doesn't delay the others).
+
+var (
+	outboxActions          = make(map[string]bool)
+	outboxMaxPerConnection = config.GetConfig().GraphqlActions.OutboxMaxPerConnection
+	outboxMaxTotal         = config.GetConfig().GraphqlActions.OutboxMaxTotal
+	outboxMaxWait          = time.Duration(config.GetConfig().GraphqlActions.OutboxMaxWaitSeconds) * time.Second
+	mutationOutbox         = &outbox{
+		queues: make(map[string]*connectionOutbox),
+		notify: make(chan struct{}, 1),
+	}
+)
+
+type outbox struct {
+	sync.Mutex
+	queues map[string]*connectionOutbox // by browser connection id
+	total  int
+	notify chan struct{}
+}
+
+type connectionOutbox struct {
+	entries   []*outboxEntry
+	replaying bool // a routine is sending the entries of this connection
+}
+
+type outboxEntry struct {
+	browserConnection *common.BrowserConnection
+	browserMessage    common.BrowserSubscribeMessage
+	actions           []MutationAction
+	sessionVariables  map[string]string
+	queuedAt          time.Time
+}
+
+func init() {
+	for _, actionName := range strings.Split(config.GetConfig().GraphqlActions.OutboxActions, ",") {
+		if actionName = strings.TrimSpace(actionName); actionName != "" {
+			outboxActions[actionName] = true
+		}
+	}
+
+	if len(outboxActions) > 0 && outboxMaxPerConnection > 0 && outboxMaxTotal > 0 {
+		graphqlActionsCircuit.onClose(mutationOutbox.notifyReplay)
+		go mutationOutbox.replayLoop()
+	}
+}
+
+// isOutboxMutation returns true when all the actions of the mutation can wait in the outbox
+func isOutboxMutation(actions []MutationAction) bool {
+	if len(actions) == 0 || outboxMaxPerConnection <= 0 || outboxMaxTotal <= 0 {
+		return false
+	}
+
+	for _, action := range actions {
+		if !outboxActions[action.Name] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// hasPending returns true when mutations of the connection are waiting (new ones must wait after them)
+func (o *outbox) hasPending(browserConnection *common.BrowserConnection) bool {
+	o.Lock()
+	defer o.Unlock()
+
+	queue, exists := o.queues[browserConnection.Id]
+	return exists && len(queue.entries) > 0
+}
+
+// add puts the mutation in the outbox, it returns false when the outbox is full (the mutation must fail)
+func (o *outbox) add(browserConnection *common.BrowserConnection, browserMessage common.BrowserSubscribeMessage, actions []MutationAction, sessionVariables map[string]string) bool {
+	o.Lock()
+	queue, exists := o.queues[browserConnection.Id]
+	rejectReason := ""
+	if o.total >= outboxMaxTotal {
+		rejectReason = "outbox_full"
+	} else if exists && len(queue.entries) >= outboxMaxPerConnection {
+		rejectReason = "connection_full"
+	}
+
+	if rejectReason != "" {
+		o.Unlock()
+		common.GqlActionsOutboxRejectedCounter.With(prometheus.Labels{"reason": rejectReason}).Inc()
+		browserConnection.Logger.Warnf("Mutation %s could not wait in the outbox (%s)", browserMessage.Payload.OperationName, rejectReason)
+		return false
+	}
+
+	if !exists {
+		queue = &connectionOutbox{}
+		o.queues[browserConnection.Id] = queue
+	}
+	queue.entries = append(queue.entries, &outboxEntry{
+		browserConnection: browserConnection,
+		browserMessage:    browserMessage,
+		actions:           actions,
+		sessionVariables:  sessionVariables,
+		queuedAt:          time.Now(),
+	})
+	o.total++
+	common.GqlActionsOutboxDepthGauge.Set(float64(o.total))
+	o.Unlock()
+
+	browserConnection.Logger.Infof("Mutation %s is waiting in the outbox until graphql actions is available", browserMessage.Payload.OperationName)
+	sendMutationPending(browserConnection, browserMessage.ID)
+	o.notifyReplay()
+
+	return true
+}
+
+func (o *outbox) notifyReplay() {
+	select {
+	case o.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (o *outbox) replayLoop() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-o.notify:
+		case <-ticker.C:
+		}
+		o.startReplays()
+	}
+}
+
+// startReplays starts a routine for each connection with mutations waiting (unless it's running already)
+func (o *outbox) startReplays() {
+	o.Lock()
+	defer o.Unlock()
+
+	for connectionId, queue := range o.queues {
+		if queue.replaying || len(queue.entries) == 0 {
+			continue
+		}
+		queue.replaying = true
+		go o.replay(connectionId, queue)
+	}
+}
+
+// replay sends the mutations of the connection one by one, stopping when graphql-actions is still unavailable
+func (o *outbox) replay(connectionId string, queue *connectionOutbox) {
+	defer func() {
+		o.Lock()
+		queue.replaying = false
+		if len(queue.entries) == 0 {
+			delete(o.queues, connectionId)
+		}
+		o.Unlock()
+	}()
+
+	for {
+		o.Lock()
+		if len(queue.entries) == 0 {
+			o.Unlock()
+			return
+		}
+		entry := queue.entries[0]
+		o.Unlock()
+
+		operationName := entry.browserMessage.Payload.OperationName
+		if entry.browserConnection.Context.Err() != nil {
+			entry.browserConnection.Logger.Debugf("Mutation %s removed from the outbox as the connection is gone", operationName)
+			o.removeFirst(queue)
+			continue
+		}
+
+		if outboxMaxWait > 0 && time.Since(entry.queuedAt) > outboxMaxWait {
+			o.removeFirst(queue)
+			common.GqlActionsOutboxRejectedCounter.With(prometheus.Labels{"reason": "expired"}).Inc()
+			for _, action := range entry.actions {
+				audit.RecordAction(entry.sessionVariables, operationName, action.Name, action.Input, common.ErrorIdOperationTimeout, time.Since(entry.queuedAt))
+			}
+			common.SendErrorMessage(
+				entry.browserConnection,
+				entry.browserMessage.ID,
+				common.ErrorIdOperationTimeout,
+				fmt.Sprintf("Mutation %s waited %v in the outbox without graphql actions being available", operationName, outboxMaxWait))
+			continue
+		}
+
+		if !graphqlActionsCircuit.isClosing() {
+			return
+		}
+
+		timeout := common.GetOperationTimeout(common.Mutation, operationName)
+		responseData, failedAction, latencies, err := sendMutationActions(entry.browserConnection.Context, entry.browserConnection, entry.browserMessage, entry.actions, entry.sessionVariables, timeout)
+		if err != nil && isTransientError(err) {
+			// Keep it first, to try again when the circuit closes
+			return
+		}
+
+		o.removeFirst(queue)
+		common.GqlActionsOutboxReplayLatency.Observe(time.Since(entry.queuedAt).Seconds())
+		auditMutation(entry.browserMessage, entry.actions, entry.sessionVariables, latencies, err)
+		respondMutation(entry.browserConnection, entry.browserMessage, entry.actions, responseData, failedAction, err, timeout)
+	}
+}
+
+func (o *outbox) removeFirst(queue *connectionOutbox) {
+	o.Lock()
+	defer o.Unlock()
+
+	queue.entries[0] = nil
+	queue.entries = queue.entries[1:]
+	o.total--
+	common.GqlActionsOutboxDepthGauge.Set(float64(o.total))
+}
+
+// sendMutationPending tells the browser the mutation is in the outbox
+// graphql-transport-ws allows a `pong` at any time (unlike a `ping`, it's not answered and it doesn't interfere with the operation)
+func sendMutationPending(browserConnection *common.BrowserConnection, messageId string) {
+	browserPendingMessage := map[string]interface{}{
+		"type": "pong",
+		"payload": map[string]interface{}{
+			"pendingMutation": messageId,
+		},
+	}
+	jsonDataPending, _ := json.Marshal(browserPendingMessage)
+	browserConnection.FromHasuraToBrowserChannel.SendWait(browserConnection.Context, jsonDataPending)
+}
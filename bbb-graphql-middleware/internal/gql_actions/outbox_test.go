@@ -0,0 +1,60 @@
+package gql_actions
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	_ "bbb-graphql-middleware/config/configtest"
+	"bbb-graphql-middleware/internal/common"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestOutboxIsPerConnection(t *testing.T) {
+	o := &outbox{
+		queues: make(map[string]*connectionOutbox),
+		notify: make(chan struct{}, 1),
+	}
+
+	newBrowserConnection := func(id string) *common.BrowserConnection {
+		return &common.BrowserConnection{
+			Id:                         id,
+			Context:                    context.Background(),
+			FromHasuraToBrowserChannel: common.NewSafeChannelByte(outboxMaxPerConnection + 1),
+			Logger:                     log.WithField("test", t.Name()),
+		}
+	}
+	slowConnection := newBrowserConnection("BC1")
+	otherConnection := newBrowserConnection("BC2")
+
+	var browserMessage common.BrowserSubscribeMessage
+	browserMessage.ID = "1"
+	for i := 0; i < outboxMaxPerConnection; i++ {
+		if !o.add(slowConnection, browserMessage, nil, nil) {
+			t.Fatalf("mutation %d was rejected before the limit of the connection", i)
+		}
+	}
+	if o.add(slowConnection, browserMessage, nil, nil) {
+		t.Errorf("mutation was accepted above the limit of the connection")
+	}
+
+	if !o.hasPending(slowConnection) {
+		t.Errorf("expected mutations pending for %s", slowConnection.Id)
+	}
+	if o.hasPending(otherConnection) {
+		t.Errorf("mutations of %s are pending because of %s", otherConnection.Id, slowConnection.Id)
+	}
+
+	// The browser is told with a `pong` (a `ping` would be answered and taken as heartbeat by the client)
+	message, _ := slowConnection.FromHasuraToBrowserChannel.Receive()
+	var pendingMessage struct {
+		Type    string `json:"type"`
+		Payload struct {
+			PendingMutation string `json:"pendingMutation"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(message, &pendingMessage); err != nil || pendingMessage.Type != "pong" || pendingMessage.Payload.PendingMutation != "1" {
+		t.Errorf("unexpected pending message %s", message)
+	}
+}
@@ -0,0 +1,75 @@
+package gql_actions
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"bbb-graphql-middleware/config"
+	"bbb-graphql-middleware/internal/common"
+)
+
+// Retries of actions when graphql-actions is unavailable for a moment (e.g. while it restarts)
+// Only the actions of retryable_actions are sent again, carrying the same Idempotency-Key
+
+var (
+	retryableActions    = make(map[string]bool)
+	retryMaxAttempts    = max(config.GetConfig().GraphqlActions.RetryMaxAttempts, 1)
+	retryInitialBackoff = time.Duration(config.GetConfig().GraphqlActions.RetryInitialBackoffMs) * time.Millisecond
+	retryMaxBackoff     = time.Duration(config.GetConfig().GraphqlActions.RetryMaxBackoffMs) * time.Millisecond
+)
+
+func init() {
+	for _, actionName := range strings.Split(config.GetConfig().GraphqlActions.RetryableActions, ",") {
+		if actionName = strings.TrimSpace(actionName); actionName != "" {
+			retryableActions[actionName] = true
+		}
+	}
+}
+
+func shouldRetryGqlActionsRequest(actionName string, attempt int, err error) bool {
+	// No need to wait for a retry when the circuit is open, the outbox keeps the important ones
+	if attempt >= retryMaxAttempts || !retryableActions[actionName] || errors.Is(err, errCircuitOpen) {
+		return false
+	}
+
+	return isTransientError(err)
+}
+
+// isTransientError returns true when graphql-actions could not be reached or its proxy answered it's unavailable
+// Timeouts are not retried, as the action may have been executed (and the mutation has its own timeout)
+func isTransientError(err error) bool {
+	var requestError *RequestError
+	if !errors.As(err, &requestError) {
+		return false
+	}
+
+	switch requestError.StatusCode {
+	case 0:
+		return requestError.ErrorId == common.ErrorIdUpstreamUnavailable
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+
+	return false
+}
+
+// getRetryBackoff doubles the wait on each attempt (up to retry_max_backoff_ms), with some jitter
+// so the connections don't retry all at the same time
+func getRetryBackoff(attempt int) time.Duration {
+	backoff := retryInitialBackoff
+	for i := 1; i < attempt && (retryMaxBackoff <= 0 || backoff < retryMaxBackoff); i++ {
+		backoff *= 2
+	}
+	if retryMaxBackoff > 0 && backoff > retryMaxBackoff {
+		backoff = retryMaxBackoff
+	}
+
+	if backoff <= 0 {
+		return 0
+	}
+
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
@@ -0,0 +1,106 @@
+package gql_actions
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"sync"
+	"time"
+
+	"bbb-graphql-middleware/config"
+	"bbb-graphql-middleware/internal/common"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Dedicated client for graphql-actions, keeping a pool of connections alive (the default client keeps only 2 idle
+// connections per host, so they were closed and opened again under load, e.g. while drawing on the whiteboard)
+
+var (
+	graphqlActionsRequestTimeout = time.Duration(config.GetConfig().GraphqlActions.RequestTimeoutSeconds) * time.Second
+	graphqlActionsHttpClient     = &http.Client{
+		Transport: &http.Transport{
+			DialContext: (&net.Dialer{
+				Timeout:   5 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			MaxIdleConns:        config.GetConfig().GraphqlActions.MaxIdleConnections,
+			MaxIdleConnsPerHost: config.GetConfig().GraphqlActions.MaxIdleConnections,
+			MaxConnsPerHost:     config.GetConfig().GraphqlActions.MaxConnections,
+			IdleConnTimeout:     time.Duration(config.GetConfig().GraphqlActions.IdleConnectionTimeoutSeconds) * time.Second,
+		},
+	}
+)
+
+// doGqlActionsRequest executes the request with the timeout of graphql-actions, observing its latency and if the connection was reused
+func doGqlActionsRequest(ctx context.Context, request *http.Request, actionName string) (*http.Response, context.CancelFunc, error) {
+	cancel := context.CancelFunc(func() {})
+	if graphqlActionsRequestTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, graphqlActionsRequestTimeout)
+	}
+
+	if !graphqlActionsCircuit.allow() {
+		cancel()
+		return nil, nil, errCircuitOpen
+	}
+
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(connInfo httptrace.GotConnInfo) {
+			common.GqlActionsConnectionsCounter.With(prometheus.Labels{"reused": strconv.FormatBool(connInfo.Reused)}).Inc()
+		},
+	})
+
+	startedAt := time.Now()
+	response, err := graphqlActionsHttpClient.Do(request.WithContext(ctx))
+
+	status := "error"
+	statusCode := 0
+	if err == nil {
+		status = strconv.Itoa(response.StatusCode)
+		statusCode = response.StatusCode
+	}
+	common.GqlActionsRequestDuration.With(prometheus.Labels{"action": getActionLabel(actionName, statusCode), "status": status}).Observe(time.Since(startedAt).Seconds())
+
+	// Requests cancelled by the browser (it disconnected) say nothing about graphql-actions
+	if !errors.Is(err, context.Canceled) {
+		graphqlActionsCircuit.recordResult(statusCode, err)
+	}
+
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+
+	// The body is read after returning, so the context is cancelled by the caller
+	return response, cancel, nil
+}
+
+// Distinct actions used as metric label, the next ones are counted as `other`
+// The action name comes from the mutation sent by the browser, so besides the configured ones (retryable, outbox, batched)
+// only the actions graphql-actions answered successfully take a label
+const maxActionsLabels = 200
+
+var actionsLabels = make(map[string]bool)
+var actionsLabelsMutex sync.Mutex
+
+func getActionLabel(actionName string, statusCode int) string {
+	if retryableActions[actionName] || outboxActions[actionName] || actionBatchers[actionName] != nil {
+		return actionName
+	}
+
+	actionsLabelsMutex.Lock()
+	defer actionsLabelsMutex.Unlock()
+
+	if actionsLabels[actionName] {
+		return actionName
+	}
+	if statusCode >= 200 && statusCode < 300 && len(actionsLabels) < maxActionsLabels {
+		actionsLabels[actionName] = true
+		return actionName
+	}
+
+	return "other"
+}
@@ -3,22 +3,17 @@ package hasura
 import (
 	"context"
 	"fmt"
-	"math"
-	"net/http"
-	"net/http/cookiejar"
-	"net/url"
 	"sync"
 	"sync/atomic"
 
 	"bbb-graphql-middleware/config"
 	"bbb-graphql-middleware/internal/hasura/conn/reader"
 	"bbb-graphql-middleware/internal/hasura/conn/writer"
+	"bbb-graphql-middleware/internal/hasura/upstream"
 
 	"github.com/coder/websocket"
 
 	"bbb-graphql-middleware/internal/common"
-
-	"golang.org/x/xerrors"
 )
 
 var (
@@ -29,6 +24,14 @@ var (
 // Hasura client connection
 func HasuraClient(
 	browserConnection *common.BrowserConnection,
+) error {
+	return hasuraClient(browserConnection, upstream.New(hasuraEndpoint))
+}
+
+// hasuraClient runs the connection over the given upstream (tests use the fake engine)
+func hasuraClient(
+	browserConnection *common.BrowserConnection,
+	hasuraUpstream common.Upstream,
 ) error {
 	// Obtain id for this connection
 	id := atomic.AddUint64(&lastHasuraConnectionId, 1)
@@ -38,26 +41,6 @@ func HasuraClient(
 
 	defer browserConnection.Logger.Debugf("finished")
 
-	// Add sub-protocol
-	var dialOptions websocket.DialOptions
-	dialOptions.Subprotocols = append(dialOptions.Subprotocols, "graphql-transport-ws")
-
-	// Create cookie jar
-	jar, err := cookiejar.New(nil)
-	if err != nil {
-		return xerrors.Errorf("failed to create cookie jar: %w", err)
-	}
-	parsedURL, err := url.Parse(hasuraEndpoint)
-	if err != nil {
-		return xerrors.Errorf("failed to parse url: %w", err)
-	}
-	parsedURL.Scheme = "http"
-	jar.SetCookies(parsedURL, browserConnection.BrowserRequestCookies)
-	hc := &http.Client{
-		Jar: jar,
-	}
-	dialOptions.HTTPClient = hc
-
 	// Create a context for the hasura connection, that depends on the browser context
 	// this means that if browser connection is closed, the hasura connection will close also
 	// this also means that we can close the hasura connection without closing the browser one
@@ -89,15 +72,12 @@ func HasuraClient(
 	}()
 
 	// Make the connection
-	hasuraWsConn, _, err := websocket.Dial(hasuraConnectionContext, hasuraEndpoint, &dialOptions)
-	if err != nil {
-		return xerrors.Errorf("error connecting to hasura: %v", err)
+	if err := hasuraUpstream.Dial(hasuraConnectionContext, browserConnection.BrowserRequestCookies); err != nil {
+		return err
 	}
-	defer hasuraWsConn.Close(websocket.StatusInternalError, "the sky is falling")
-
-	hasuraWsConn.SetReadLimit(math.MaxInt64 - 1)
+	defer hasuraUpstream.Close(websocket.StatusInternalError, "the sky is falling")
 
-	thisConnection.Websocket = hasuraWsConn
+	thisConnection.Upstream = hasuraUpstream
 
 	// Log the connection success
 	browserConnection.Logger.Info("connected with Hasura")
@@ -0,0 +1,278 @@
+package hasura
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	_ "bbb-graphql-middleware/config/configtest"
+	"bbb-graphql-middleware/internal/common"
+	"bbb-graphql-middleware/internal/hasura/upstream"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+const userCurrentSubscription = `subscription userCurrentSubscription { user_current { userId name } }`
+
+type browserMessage struct {
+	Type    string          `json:"type"`
+	ID      string          `json:"id"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+func newTestBrowserConnection(t *testing.T) *common.BrowserConnection {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	return &common.BrowserConnection{
+		Id:                             "BC-test",
+		ActiveSubscriptions:            make(map[string]common.GraphQlSubscription),
+		ActiveStreamings:               make(map[string]string),
+		Context:                        ctx,
+		ContextCancelFunc:              cancel,
+		ConnectionInitMessage:          []byte(`{"type":"connection_init","payload":{}}`),
+		FromBrowserToHasuraChannel:     common.NewSafeChannelByte(10),
+		FromBrowserToHasuraRateLimiter: rate.NewLimiter(rate.Inf, 1),
+		FromHasuraToBrowserChannel:     common.NewSafeChannelByte(10),
+		Logger:                         log.WithField("test", t.Name()),
+	}
+}
+
+// startFakeHasuraClient runs the hasura client over a fake engine, the returned channel is closed when it finishes
+func startFakeHasuraClient(t *testing.T, bc *common.BrowserConnection, script *upstream.FakeEngineScript) chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := hasuraClient(bc, upstream.NewFakeEngine(script)); err != nil {
+			t.Errorf("hasura client finished with error: %v", err)
+		}
+	}()
+
+	return done
+}
+
+func receiveFromHasura(t *testing.T, bc *common.BrowserConnection) browserMessage {
+	t.Helper()
+
+	select {
+	case message := <-bc.FromHasuraToBrowserChannel.ReceiveChannel():
+		var received browserMessage
+		if err := json.Unmarshal(message, &received); err != nil {
+			t.Fatalf("invalid message sent to browser %s: %v", message, err)
+		}
+		return received
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout waiting for a message to the browser")
+	}
+
+	return browserMessage{}
+}
+
+func sendToHasura(t *testing.T, bc *common.BrowserConnection, id string, operationName string, query string) {
+	t.Helper()
+
+	message, _ := json.Marshal(map[string]interface{}{
+		"id":   id,
+		"type": "subscribe",
+		"payload": map[string]interface{}{
+			"operationName": operationName,
+			"query":         query,
+			"variables":     map[string]interface{}{},
+		},
+	})
+	if !bc.FromBrowserToHasuraChannel.SendWait(bc.Context, message) {
+		t.Fatalf("failed to send %s", operationName)
+	}
+}
+
+func expectMessage(t *testing.T, bc *common.BrowserConnection, messageType string, id string) browserMessage {
+	t.Helper()
+
+	received := receiveFromHasura(t, bc)
+	if received.Type != messageType || received.ID != id {
+		t.Fatalf("expected %s for %q, received %s for %q: %s", messageType, id, received.Type, received.ID, received.Payload)
+	}
+
+	return received
+}
+
+func isOperationActive(bc *common.BrowserConnection, id string) bool {
+	bc.ActiveSubscriptionsMutex.RLock()
+	defer bc.ActiveSubscriptionsMutex.RUnlock()
+	_, exists := bc.ActiveSubscriptions[id]
+	return exists
+}
+
+func userCurrentData(name string) map[string]interface{} {
+	return map[string]interface{}{
+		"user_current": []interface{}{map[string]interface{}{"userId": "user-1", "name": name}},
+	}
+}
+
+func TestHasuraClientSubscription(t *testing.T) {
+	bc := newTestBrowserConnection(t)
+	done := startFakeHasuraClient(t, bc, &upstream.FakeEngineScript{
+		Operations: map[string]upstream.FakeEngineOperation{
+			"userCurrentSubscription": {
+				Results: []upstream.FakeEngineResult{
+					{Data: userCurrentData("Alice")},
+					{Data: userCurrentData("Alice"), DelayMs: 10}, // same data, not forwarded
+					{Data: userCurrentData("Bob"), DelayMs: 10},
+				},
+				Complete: true,
+			},
+		},
+	})
+
+	expectMessage(t, bc, "connection_ack", "")
+
+	sendToHasura(t, bc, "1", "userCurrentSubscription", userCurrentSubscription)
+
+	first := expectMessage(t, bc, "next", "1")
+	second := expectMessage(t, bc, "next", "1")
+	if string(first.Payload) == string(second.Payload) {
+		t.Errorf("the same data was forwarded twice: %s", first.Payload)
+	}
+
+	expectMessage(t, bc, "complete", "1")
+	if isOperationActive(bc, "1") {
+		t.Errorf("subscription is still active after complete")
+	}
+
+	bc.ContextCancelFunc()
+	<-done
+}
+
+func TestHasuraClientQueryError(t *testing.T) {
+	bc := newTestBrowserConnection(t)
+	done := startFakeHasuraClient(t, bc, &upstream.FakeEngineScript{
+		Operations: map[string]upstream.FakeEngineOperation{
+			"getUserInfo": {
+				Results: []upstream.FakeEngineResult{
+					{Errors: []map[string]interface{}{
+						{"message": "field not found", "extensions": map[string]interface{}{"code": "validation-failed"}},
+					}},
+				},
+			},
+		},
+	})
+
+	expectMessage(t, bc, "connection_ack", "")
+
+	sendToHasura(t, bc, "1", "getUserInfo", `query getUserInfo { user_current { userId } }`)
+
+	received := expectMessage(t, bc, "error", "1")
+	var payload []struct {
+		Message   string `json:"message"`
+		MessageId string `json:"messageId"`
+	}
+	if err := json.Unmarshal(received.Payload, &payload); err != nil || len(payload) != 1 {
+		t.Fatalf("invalid error payload %s: %v", received.Payload, err)
+	}
+	if payload[0].MessageId != common.ErrorIdValidationFailed {
+		t.Errorf("expected messageId %s, received %s", common.ErrorIdValidationFailed, payload[0].MessageId)
+	}
+	if payload[0].Message == "field not found" {
+		t.Errorf("the error from Hasura was forwarded to the browser")
+	}
+
+	if isOperationActive(bc, "1") {
+		t.Errorf("query is still active after the error")
+	}
+
+	bc.ContextCancelFunc()
+	<-done
+}
+
+func TestHasuraClientReconnectionRetransmitsSubscriptions(t *testing.T) {
+	bc := newTestBrowserConnection(t)
+	done := startFakeHasuraClient(t, bc, &upstream.FakeEngineScript{
+		Default: &upstream.FakeEngineOperation{
+			Results: []upstream.FakeEngineResult{{Data: userCurrentData("Alice")}},
+		},
+	})
+
+	expectMessage(t, bc, "connection_ack", "")
+	sendToHasura(t, bc, "1", "userCurrentSubscription", userCurrentSubscription)
+	expectMessage(t, bc, "next", "1")
+
+	// Invalidate the hasura connection only (as in /graphql-reconnection)
+	bc.HasuraConnection.ContextCancelFunc()
+	<-done
+
+	done = startFakeHasuraClient(t, bc, &upstream.FakeEngineScript{
+		Default: &upstream.FakeEngineOperation{
+			Results: []upstream.FakeEngineResult{
+				{Data: userCurrentData("Alice")}, // same data received before reconnecting, not forwarded
+				{Data: userCurrentData("Bob"), DelayMs: 10},
+			},
+		},
+	})
+
+	// connection_ack is not sent again, the retransmitted subscription keeps receiving data
+	expectMessage(t, bc, "next", "1")
+
+	select {
+	case <-bc.Context.Done():
+		t.Fatalf("browser connection was closed, the retransmission was handled as a duplicate subscriber")
+	default:
+	}
+
+	bc.ActiveSubscriptionsMutex.RLock()
+	subscription := bc.ActiveSubscriptions["1"]
+	bc.ActiveSubscriptionsMutex.RUnlock()
+	if subscription.PendingRetransmissions != 0 {
+		t.Errorf("expected no pending retransmissions, got %d", subscription.PendingRetransmissions)
+	}
+	if subscription.LastSeenOnHasuraConnection != bc.HasuraConnection.Id {
+		t.Errorf("subscription was not sent to the new hasura connection")
+	}
+
+	bc.ContextCancelFunc()
+	<-done
+}
+
+func TestHasuraClientHeldQueryIsReleasedOnReconnection(t *testing.T) {
+	bc := newTestBrowserConnection(t)
+	bc.BBBWebSessionVariables = map[string]string{"x-hasura-role": "bbb_client_not_in_meeting"}
+	script := &upstream.FakeEngineScript{
+		Default: &upstream.FakeEngineOperation{
+			Results: []upstream.FakeEngineResult{{Data: map[string]interface{}{"chat": []interface{}{}}}},
+		},
+	}
+	done := startFakeHasuraClient(t, bc, script)
+
+	expectMessage(t, bc, "connection_ack", "")
+	sendToHasura(t, bc, "1", "getChatList", `query getChatList { chat { chatId } }`)
+
+	// Held by the policy (not-in-meeting rule): not sent to Hasura and not timed
+	deadline := time.Now().Add(5 * time.Second)
+	for !isOperationActive(bc, "1") && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	bc.ActiveSubscriptionsMutex.RLock()
+	subscription := bc.ActiveSubscriptions["1"]
+	bc.ActiveSubscriptionsMutex.RUnlock()
+	if !subscription.Held || subscription.TimeoutTimer != nil {
+		t.Fatalf("expected a held query without timeout, got held=%v timer=%v", subscription.Held, subscription.TimeoutTimer != nil)
+	}
+
+	// User joined the meeting, the query is sent after reconnecting with Hasura
+	bc.Lock()
+	bc.BBBWebSessionVariables = map[string]string{"x-hasura-role": "bbb_client"}
+	bc.Unlock()
+	bc.HasuraConnection.ContextCancelFunc()
+	<-done
+	done = startFakeHasuraClient(t, bc, script)
+
+	expectMessage(t, bc, "next", "1")
+	expectMessage(t, bc, "complete", "1")
+	if isOperationActive(bc, "1") {
+		t.Errorf("query is still active after complete")
+	}
+
+	bc.ContextCancelFunc()
+	<-done
+}
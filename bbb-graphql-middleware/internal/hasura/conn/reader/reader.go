@@ -30,7 +30,7 @@ func HasuraConnectionReader(hc *common.HasuraConnection, wg *sync.WaitGroup) {
 	defer hc.ContextCancelFunc()
 
 	for {
-		messageType, message, err := hc.Websocket.Read(hc.Context)
+		messageType, message, err := hc.Upstream.Receive(hc.Context)
 		var closeError *websocket.CloseError
 
 		if err != nil {
@@ -38,7 +38,7 @@ func HasuraConnectionReader(hc *common.HasuraConnection, wg *sync.WaitGroup) {
 				hc.BrowserConn.Logger.Debugf("Closing Hasura ws connection as Context was cancelled!")
 			} else if errors.As(err, &closeError) {
 				hc.WebsocketCloseError = closeError
-				hc.BrowserConn.Logger.Debug("Hasura WebSocket connection closed: status = %v, reason = %s", closeError.Code, closeError.Reason)
+				hc.BrowserConn.Logger.Debugf("Hasura WebSocket connection closed: status = %v, reason = %s", closeError.Code, closeError.Reason)
 				// TODO check if it should send {"type":"connection_error","payload":"Authentication hook unauthorized this request"}
 			} else {
 				if websocket.CloseStatus(err) == -1 {
@@ -61,13 +61,14 @@ func HasuraConnectionReader(hc *common.HasuraConnection, wg *sync.WaitGroup) {
 			continue
 		}
 
-		hc.BrowserConn.Logger.Tracef("received from hasura: %s", string(message))
+		hc.BrowserConn.Logger.Tracef("received from hasura: %s", common.RedactSessionTokensInJson(string(message)))
+		common.ObserveWebsocketMessage(common.WebsocketEndpointHasura, "received", len(message))
 
 		handleMessageReceivedFromHasura(hc, message)
 	}
 }
 
-var QueryIdPlaceholderInBytes = []byte("--------------QUERY-ID--------------") // 36 chars
+var QueryIdPlaceholderInBytes = common.QueryIdPlaceholderInBytes
 
 func handleMessageReceivedFromHasura(hc *common.HasuraConnection, message []byte) {
 	type HasuraMessageInfo struct {
@@ -94,11 +95,24 @@ func handleMessageReceivedFromHasura(hc *common.HasuraConnection, message []byte
 			return
 		}
 
+		// First response of a query: its timeout must be cleared before forwarding it
+		if subscription.TimeoutTimer != nil && !clearQueryTimeout(hc, hasuraMessageInfo.ID) {
+			hc.BrowserConn.Logger.Debugf("Query with Id %s already timed out, skipping response.", hasuraMessageInfo.ID)
+			return
+		}
+
 		// When Hasura send msg type "complete", this query is finished
-		if hasuraMessageInfo.Type == "complete" {
+		// A query that received "error" is finished as well (Hasura will not send "complete" after it)
+		if hasuraMessageInfo.Type == "complete" ||
+			(hasuraMessageInfo.Type == "error" && subscription.Type == common.Query) {
 			handleCompleteMessage(hc, hasuraMessageInfo.ID)
 		}
 
+		// Hasura errors are translated into BBB error codes, the original error is only logged
+		if hasuraMessageInfo.Type == "error" {
+			message = translateHasuraErrorMessage(hc, message, subscription)
+		}
+
 		if hasuraMessageInfo.Type == "next" {
 			common.GqlReceivedDataCounter.
 				With(prometheus.Labels{
@@ -143,7 +157,7 @@ func handleMessageReceivedFromHasura(hc *common.HasuraConnection, message []byte
 						for _, connectionStatusMessage := range connectionStatusMessages {
 							if connectionStatusMessage.TraceLog != "" {
 								newTrace := fmt.Sprintf("%s@pg|%s@gqlmiddleware|%s", connectionStatusMessage.TraceLog, connectionStatusMessage.StatusUpdatedAt, now.Format("2006-01-02T15:04:05.000Z"))
-								hc.BrowserConn.Logger.Infof("Received %s meetingId=%s userId=%s sessionToken=%s", newTrace, connectionStatusMessage.MeetingId, connectionStatusMessage.UserId, connectionStatusMessage.SessionToken)
+								hc.BrowserConn.Logger.Infof("Received %s meetingId=%s userId=%s sessionToken=%s", newTrace, connectionStatusMessage.MeetingId, connectionStatusMessage.UserId, common.RedactSessionToken(connectionStatusMessage.SessionToken))
 
 								go includePromotheusMetrics(newTrace, connectionStatusMessage.MeetingId, hc.BrowserConn.Logger)
 
@@ -198,6 +212,11 @@ func handleSubscriptionMessage(hc *common.HasuraConnection, message *[]byte, sub
 	hc.BrowserConn.ActiveSubscriptions[queryId] = subscription
 	hc.BrowserConn.ActiveSubscriptionsMutex.Unlock()
 
+	// Share the result with other connections (warm start of new subscriptions)
+	if subscription.CacheKey != "" {
+		common.StoreSubscriptionCache(subscription.CacheKey, *message, dataChecksum, messageData)
+	}
+
 	// Apply msg patch when it supports it
 	if subscription.JsonPatchSupported {
 		*message = msgpatch.GetPatchedMessage(*message, messageDataKey, lastReceivedDataWas, messageData, cacheKey, lastDataChecksumWas, dataChecksum)
@@ -221,15 +240,72 @@ func handleStreamingMessage(hc *common.HasuraConnection, message []byte, subscri
 	}
 }
 
+// clearQueryTimeout stops the timeout of the query, it returns false when the timeout already fired
+// (the browser receives the timeout error, so the response is dropped)
+func clearQueryTimeout(hc *common.HasuraConnection, queryId string) bool {
+	hc.BrowserConn.ActiveSubscriptionsMutex.Lock()
+	defer hc.BrowserConn.ActiveSubscriptionsMutex.Unlock()
+
+	subscription, exists := hc.BrowserConn.ActiveSubscriptions[queryId]
+	if !exists {
+		return false
+	}
+	if subscription.TimeoutTimer == nil {
+		return true
+	}
+	if !subscription.TimeoutTimer.Stop() {
+		return false
+	}
+
+	subscription.TimeoutTimer = nil
+	hc.BrowserConn.ActiveSubscriptions[queryId] = subscription
+	return true
+}
+
 func handleCompleteMessage(hc *common.HasuraConnection, queryId string) {
 	hc.BrowserConn.ActiveSubscriptionsMutex.Lock()
 	queryType := hc.BrowserConn.ActiveSubscriptions[queryId].Type
 	operationName := hc.BrowserConn.ActiveSubscriptions[queryId].OperationName
+	if timeoutTimer := hc.BrowserConn.ActiveSubscriptions[queryId].TimeoutTimer; timeoutTimer != nil {
+		timeoutTimer.Stop()
+	}
 	delete(hc.BrowserConn.ActiveSubscriptions, queryId)
 	hc.BrowserConn.ActiveSubscriptionsMutex.Unlock()
 	hc.BrowserConn.Logger.Debugf("%s (%s) with Id %s finished by Hasura.", queryType, operationName, queryId)
 }
 
+func translateHasuraErrorMessage(hc *common.HasuraConnection, message []byte, subscription common.GraphQlSubscription) []byte {
+	type HasuraErrorMessage struct {
+		Type    string `json:"type"`
+		ID      string `json:"id"`
+		Payload []struct {
+			Message    string                 `json:"message"`
+			Extensions map[string]interface{} `json:"extensions"`
+		} `json:"payload"`
+	}
+	var hasuraErrorMessage HasuraErrorMessage
+	if err := json.Unmarshal(message, &hasuraErrorMessage); err != nil {
+		hc.BrowserConn.Logger.Errorf("failed to unmarshal error message: %v", err)
+		return message
+	}
+
+	errorId := common.ErrorIdInternalError
+	for _, hasuraError := range hasuraErrorMessage.Payload {
+		hasuraErrorCode, _ := hasuraError.Extensions["code"].(string)
+		errorId = common.GetErrorIdFromHasuraErrorCode(hasuraErrorCode)
+		hc.BrowserConn.Logger.Errorf("Hasura returned error for %s (%s): %s (code=%s, extensions=%v)",
+			subscription.OperationName, hasuraErrorMessage.ID, hasuraError.Message, hasuraErrorCode, hasuraError.Extensions)
+	}
+
+	browserErrorMessage, _ := json.Marshal(map[string]interface{}{
+		"id":      hasuraErrorMessage.ID,
+		"type":    "error",
+		"payload": common.BuildErrorPayload(errorId, common.GetErrorMessage(errorId)),
+	})
+
+	return browserErrorMessage
+}
+
 func handleConnectionAckMessage(hc *common.HasuraConnection, message []byte) {
 	hc.BrowserConn.Logger.Debugf("Received connection_ack")
 	// Hasura connection was initialized, now it's able to send new messages to Hasura
@@ -1,41 +1,28 @@
 package writer
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"slices"
 	"strings"
 	"sync"
 	"time"
 
 	"bbb-graphql-middleware/config"
 	"bbb-graphql-middleware/internal/common"
+	"bbb-graphql-middleware/internal/policy"
+	schemavalidation "bbb-graphql-middleware/internal/schema_validation"
 
-	"github.com/coder/websocket"
 	"github.com/graphql-go/graphql/language/ast"
-	"github.com/graphql-go/graphql/language/parser"
-	"github.com/graphql-go/graphql/language/source"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
 var (
-	allowedSubscriptions []string
-	deniedSubscriptions  []string
-	jsonPatchDisabled    = config.GetConfig().Server.JsonPatchDisabled
+	jsonPatchDisabled = config.GetConfig().Server.JsonPatchDisabled
 )
 
-func init() {
-	if config.GetConfig().Server.SubscriptionAllowedList != "" {
-		allowedSubscriptions = strings.Split(config.GetConfig().Server.SubscriptionAllowedList, ",")
-	}
-
-	if config.GetConfig().Server.SubscriptionsDeniedList != "" {
-		deniedSubscriptions = strings.Split(config.GetConfig().Server.SubscriptionsDeniedList, ",")
-	}
-}
-
 // HasuraConnectionWriter
 // process messages (middleware to hasura)
 func HasuraConnectionWriter(hc *common.HasuraConnection, wg *sync.WaitGroup, initMessage []byte) {
@@ -53,7 +40,7 @@ func HasuraConnectionWriter(hc *common.HasuraConnection, wg *sync.WaitGroup, ini
 	}
 
 	// Send init connection message to Hasura to start
-	err := hc.Websocket.Write(hc.Context, websocket.MessageText, initMessage)
+	err := hc.Upstream.Send(hc.Context, initMessage)
 	if err != nil {
 		hc.BrowserConn.Logger.Errorf("error on write authentication (init) message (we're disconnected from hasura): %v", err)
 		return
@@ -79,15 +66,40 @@ RangeLoop:
 					return
 				}
 
+				// Operations held by the policy are stored but not sent to Hasura (until the policy allows them)
+				holdOperation := false
+
 				if browserMessage.Type == "subscribe" {
 					queryId := browserMessage.ID
 
+					// Only the retransmitter (after reconnecting with Hasura) can send the id of an active operation again
+					// Retransmissions were checked already, so they skip the policy, validation and cost below
+					// except when the operation was held by the policy (it's checked when it's released)
+					browserConnection.ActiveSubscriptionsMutex.Lock()
+					existingSubscription, queryIdExists := browserConnection.ActiveSubscriptions[queryId]
+					isRetransmission := queryIdExists && existingSubscription.PendingRetransmissions > 0
+					if isRetransmission {
+						existingSubscription.PendingRetransmissions--
+						browserConnection.ActiveSubscriptions[queryId] = existingSubscription
+					}
+					browserConnection.ActiveSubscriptionsMutex.Unlock()
+
+					if queryIdExists && !isRetransmission {
+						common.CloseDuplicateSubscriber(browserConnection, queryId)
+						continue
+					}
+					alreadyChecked := isRetransmission && !existingSubscription.Held
+
 					// Rate limiter from config max_connection_queries_per_minute
-					ctxRateLimiter, _ := context.WithTimeout(hc.Context, 30*time.Second)
-					if err := hc.BrowserConn.FromBrowserToHasuraRateLimiter.Wait(ctxRateLimiter); err != nil {
-						sendErrorMessage(
+					ctxRateLimiter, cancelRateLimiter := context.WithTimeout(hc.Context, 30*time.Second)
+					err := hc.BrowserConn.FromBrowserToHasuraRateLimiter.Wait(ctxRateLimiter)
+					cancelRateLimiter()
+					if err != nil {
+						common.AddAbuseScore(browserConnection, common.AbuseReasonRateLimited)
+						common.SendErrorMessage(
 							browserConnection,
 							queryId,
+							common.ErrorIdRateLimited,
 							fmt.Sprintf("Rate limit exceeded: Maximum %d queries per minute allowed. Please try again later.", config.GetConfig().Server.MaxConnectionQueriesPerMinute),
 						)
 
@@ -97,18 +109,68 @@ RangeLoop:
 					// Identify type based on query string
 					messageType := common.Query
 					var lastReceivedDataChecksum uint32
+					var lastReceivedData common.HasuraMessage
+					var timeoutTimer *time.Timer
+					var cacheKey string
+					var cachedMessage []byte
 					streamCursorField := ""
 					streamCursorVariableName := ""
 					var streamCursorInitialValue interface{}
 
 					query := browserMessage.Payload.Query
 
-					if config.GetConfig().Server.MaxQueryDepth > 0 {
-						queryDepth, _ := calculateQueryDepth(query)
+					// Parse the query once to classify the operation
+					// Queries that can't be parsed are rejected, as the checks below rely on the parsed query
+					operationInfo, errParse := common.GetOperationInfo(query, browserMessage.Payload.OperationName)
+					if errParse != nil {
+						hc.BrowserConn.Logger.Debugf("Query %s is not valid: %v", browserMessage.Payload.OperationName, errParse)
+						common.AddAbuseScore(browserConnection, common.AbuseReasonRejectedQuery)
+						common.SendErrorMessage(browserConnection, queryId, common.ErrorIdValidationFailed, common.GetErrorMessage(common.ErrorIdValidationFailed))
+						continue
+					}
+
+					// Check the operation policy of the role (and other session variables)
+					policyQueryType := common.Query
+					if operationInfo != nil {
+						policyQueryType = operationInfo.Type
+					}
+					browserConnection.RLock()
+					policyDecision := policy.Evaluate(browserConnection.BBBWebSessionVariables, policyQueryType, browserMessage.Payload.OperationName)
+					browserConnection.RUnlock()
+					if !policyDecision.Allowed {
+						if policyDecision.Hold {
+							hc.BrowserConn.Logger.Debugf("Not sending to Hasura %s because it's held by the policy rule %s", browserMessage.Payload.OperationName, policyDecision.Rule)
+							holdOperation = true
+						} else if !isRetransmission {
+							common.AddAbuseScore(browserConnection, common.AbuseReasonRejectedQuery)
+							common.SendErrorMessage(
+								browserConnection,
+								queryId,
+								common.ErrorIdPermissionDenied,
+								fmt.Sprintf("Operation %s is not allowed by the policy rule %s", browserMessage.Payload.OperationName, policyDecision.Rule))
+							continue
+						}
+					}
+
+					// Fragments spreading each other would be expanded forever by the depth and cost calculations
+					if common.HasFragmentCycle(common.GetFragmentDefinitions(operationInfo.Document)) {
+						common.AddAbuseScore(browserConnection, common.AbuseReasonRejectedQuery)
+						common.SendErrorMessage(
+							browserConnection,
+							queryId,
+							common.ErrorIdValidationFailed,
+							fmt.Sprintf("Query %s is not valid as its fragments spread each other", browserMessage.Payload.OperationName))
+						continue
+					}
+
+					if config.GetConfig().Server.MaxQueryDepth > 0 && operationInfo != nil {
+						queryDepth := calculateQueryDepth(operationInfo.Document)
 						if queryDepth > config.GetConfig().Server.MaxQueryDepth {
-							sendErrorMessage(
+							common.AddAbuseScore(browserConnection, common.AbuseReasonRejectedQuery)
+							common.SendErrorMessage(
 								browserConnection,
 								queryId,
+								common.ErrorIdLimitExceeded,
 								fmt.Sprintf("Query %s is not valid with depth %d and the max allowed is %d", browserMessage.Payload.OperationName, queryDepth, config.GetConfig().Server.MaxQueryDepth))
 							continue
 						}
@@ -117,25 +179,94 @@ RangeLoop:
 					if config.GetConfig().Server.MaxQueryLength > 0 {
 						queryLength := len(query)
 						if queryLength > config.GetConfig().Server.MaxQueryLength {
-							sendErrorMessage(
+							common.AddAbuseScore(browserConnection, common.AbuseReasonOversizedPayload)
+							common.SendErrorMessage(
 								browserConnection,
 								queryId,
+								common.ErrorIdLimitExceeded,
 								fmt.Sprintf("Query %s is not valid with length %d and the max allowed is %d", browserMessage.Payload.OperationName, queryLength, config.GetConfig().Server.MaxQueryLength))
 							continue
 						}
 					}
 
-					if query != "" {
-						if strings.HasPrefix(query, "subscription") {
-							if config.GetConfig().Server.MaxConnectionConcurrentSubscriptions > 0 {
+					// Introspection can be denied to all roles or allowed only to some of them
+					if operationInfo != nil && operationInfo.IsIntrospection {
+						browserConnection.RLock()
+						role := browserConnection.BBBWebSessionVariables["x-hasura-role"]
+						browserConnection.RUnlock()
+
+						if !common.IsIntrospectionAllowed(role) {
+							browserConnection.Logger.Warnf("Introspection query %s denied for role %s", browserMessage.Payload.OperationName, role)
+							common.AddAbuseScore(browserConnection, common.AbuseReasonRejectedQuery)
+							common.SendErrorMessage(
+								browserConnection,
+								queryId,
+								common.ErrorIdPermissionDenied,
+								fmt.Sprintf("Introspection is not allowed for role %s", role))
+							continue
+						}
+					}
+
+					// Validate against the schema of the role before sending to Hasura
+					// Held operations are validated when they are released (the current role can't see their fields)
+					if operationInfo != nil && schemavalidation.Enabled && !holdOperation && !alreadyChecked {
+						browserConnection.RLock()
+						role := browserConnection.BBBWebSessionVariables["x-hasura-role"]
+						browserConnection.RUnlock()
+
+						if validationErrors := schemavalidation.ValidateOperation(role, operationInfo, browserMessage.Payload.Variables); len(validationErrors) > 0 {
+							browserConnection.Logger.Errorf("Query %s is not valid: %s", browserMessage.Payload.OperationName, validationErrors[0].Message)
+							common.AddAbuseScore(browserConnection, common.AbuseReasonRejectedQuery)
+							removeHeldOperation(browserConnection, queryId)
+							common.SendErrorPayload(browserConnection, queryId, schemavalidation.BuildErrorPayload(validationErrors))
+							continue
+						}
+					}
+
+					// Estimated cost of the query (retransmissions after reconnecting with Hasura don't consume the budget again)
+					// Held operations are charged when they are released
+					if operationInfo != nil && (config.GetConfig().Server.MaxQueryCost > 0 || browserConnection.QueryCostBudgetLimiter != nil) && !holdOperation && !alreadyChecked {
+						// Costs above both limits are rejected anyway, so the calculation stops there
+						queryCostCeiling := max(config.GetConfig().Server.MaxQueryCost, config.GetConfig().Server.MaxConnectionQueryCostPerMinute) + 1
+						queryCost := common.CalculateQueryCost(operationInfo, browserMessage.Payload.Variables, queryCostCeiling)
+						if config.GetConfig().Server.MaxQueryCost > 0 && queryCost > config.GetConfig().Server.MaxQueryCost {
+							common.GqlQueryCostRejectedCounter.With(prometheus.Labels{"reason": "max_query_cost", "operationName": browserMessage.Payload.OperationName}).Inc()
+							common.AddAbuseScore(browserConnection, common.AbuseReasonRejectedQuery)
+							removeHeldOperation(browserConnection, queryId)
+							common.SendErrorMessage(
+								browserConnection,
+								queryId,
+								common.ErrorIdLimitExceeded,
+								fmt.Sprintf("Query %s is not valid with cost %d and the max allowed is %d", browserMessage.Payload.OperationName, queryCost, config.GetConfig().Server.MaxQueryCost))
+							continue
+						}
+
+						if browserConnection.QueryCostBudgetLimiter != nil && !browserConnection.QueryCostBudgetLimiter.AllowN(time.Now(), queryCost) {
+							common.GqlQueryCostRejectedCounter.With(prometheus.Labels{"reason": "budget", "operationName": browserMessage.Payload.OperationName}).Inc()
+							common.AddAbuseScore(browserConnection, common.AbuseReasonRateLimited)
+							removeHeldOperation(browserConnection, queryId)
+							common.SendErrorMessage(
+								browserConnection,
+								queryId,
+								common.ErrorIdRateLimited,
+								fmt.Sprintf("Query %s with cost %d exceeds the budget of %d per minute. Please try again later.", browserMessage.Payload.OperationName, queryCost, config.GetConfig().Server.MaxConnectionQueryCostPerMinute))
+							continue
+						}
+					}
+
+					if operationInfo != nil {
+						if operationInfo.OperationType == ast.OperationTypeSubscription {
+							if config.GetConfig().Server.MaxConnectionConcurrentSubscriptions > 0 && !isRetransmission {
 								browserConnection.ActiveSubscriptionsMutex.RLock()
 								totalOfActiveSubscriptions := len(browserConnection.ActiveSubscriptions)
 								browserConnection.ActiveSubscriptionsMutex.RUnlock()
 
 								if totalOfActiveSubscriptions >= config.GetConfig().Server.MaxConnectionConcurrentSubscriptions {
-									sendErrorMessage(
+									common.AddAbuseScore(browserConnection, common.AbuseReasonRejectedQuery)
+									common.SendErrorMessage(
 										browserConnection,
 										queryId,
+										common.ErrorIdLimitExceeded,
 										fmt.Sprintf("Limit exceeded: Maximum %d concurrent subscriptions allowed.", config.GetConfig().Server.MaxConnectionConcurrentSubscriptions),
 									)
 
@@ -143,62 +274,65 @@ RangeLoop:
 								}
 							}
 
-							// Validate if subscription is allowed
-							if len(allowedSubscriptions) > 0 {
-								subscriptionAllowed := slices.Contains(allowedSubscriptions, browserMessage.Payload.OperationName)
-
-								if !subscriptionAllowed {
-									hc.BrowserConn.Logger.Infof("Subscription %s not allowed!", browserMessage.Payload.OperationName)
-									continue
-								}
+							if isRetransmission {
+								lastReceivedDataChecksum = existingSubscription.LastReceivedDataChecksum
+								streamCursorField = existingSubscription.StreamCursorField
+								streamCursorVariableName = existingSubscription.StreamCursorVariableName
+								streamCursorInitialValue = existingSubscription.StreamCursorCurrValue
 							}
 
-							// Validate if subscription is allowed
-							if len(deniedSubscriptions) > 0 {
-								subscriptionAllowed := !slices.Contains(deniedSubscriptions, browserMessage.Payload.OperationName)
-
-								if !subscriptionAllowed {
-									hc.BrowserConn.Logger.Infof("Subscription %s not allowed!", browserMessage.Payload.OperationName)
-									continue
-								}
-							}
+							if operationInfo.Type == common.Streaming && !isRetransmission {
+								streamCursorField, streamCursorVariableName, streamCursorInitialValue = common.GetStreamCursorPropsFromBrowserMessage(browserMessage)
 
-							messageType = common.Subscription
+								// It's necessary to assure the cursor field will return in the result of the query
+								// To be able to store the last received cursor value
+								browserMessage.Payload.Query = common.PatchQueryIncludingCursorField(query, browserMessage.Payload.OperationName, streamCursorField)
 
-							browserConnection.ActiveSubscriptionsMutex.RLock()
-							existingSubscriptionData, queryIdExists := browserConnection.ActiveSubscriptions[queryId]
-							browserConnection.ActiveSubscriptionsMutex.RUnlock()
-							if queryIdExists {
-								lastReceivedDataChecksum = existingSubscriptionData.LastReceivedDataChecksum
-								streamCursorField = existingSubscriptionData.StreamCursorField
-								streamCursorVariableName = existingSubscriptionData.StreamCursorVariableName
-								streamCursorInitialValue = existingSubscriptionData.StreamCursorCurrValue
+								newMessageJson, _ := json.Marshal(browserMessage)
+								fromBrowserMessage = newMessageJson
 							}
 
-							if strings.Contains(query, "_stream(") && strings.Contains(query, "cursor: {") {
-								messageType = common.Streaming
-								if !queryIdExists {
-									streamCursorField, streamCursorVariableName, streamCursorInitialValue = common.GetStreamCursorPropsFromBrowserMessage(browserMessage)
-
-									// It's necessary to assure the cursor field will return in the result of the query
-									// To be able to store the last received cursor value
-									browserMessage.Payload.Query = common.PatchQueryIncludingCursorField(query, streamCursorField)
-
-									newMessageJson, _ := json.Marshal(browserMessage)
-									fromBrowserMessage = newMessageJson
+							messageType = operationInfo.Type
+
+							// Warm start: send the latest result received by another connection right away
+							// The first message from Hasura will be skipped if it contains the same data (same checksum)
+							// Held operations must not receive data (the cache key may not include the role)
+							if messageType == common.Subscription && common.SubscriptionCacheEnabled && !holdOperation {
+								if isRetransmission {
+									cacheKey = existingSubscription.CacheKey
+								} else {
+									browserConnection.RLock()
+									cacheKey = common.GetSubscriptionCacheKey(browserMessage, browserConnection.BBBWebSessionVariables)
+									browserConnection.RUnlock()
+
+									if cachedResult, cacheExists := common.GetSubscriptionCache(cacheKey); cacheExists {
+										lastReceivedDataChecksum = cachedResult.DataChecksum
+										lastReceivedData = cachedResult.Data
+										cachedMessage = bytes.Replace(cachedResult.Message, common.QueryIdPlaceholderInBytes, []byte(queryId), 1)
+									}
 								}
 							}
-
-							if strings.Contains(query, "_aggregate") && strings.Contains(query, "aggregate {") {
-								messageType = common.SubscriptionAggregate
-							}
 						}
 
-						if strings.HasPrefix(query, "mutation") {
+						if operationInfo.Type == common.Mutation {
 							messageType = common.Mutation
 						}
 					}
 
+					// Queries must be answered in time, otherwise the client will receive an error
+					// When it's a retransmission (after reconnecting with Hasura) the deadline of the first attempt is kept
+					// Held queries are timed from when they are released (sent to Hasura)
+					if messageType == common.Query && !holdOperation {
+						if alreadyChecked {
+							timeoutTimer = existingSubscription.TimeoutTimer
+						} else if timeout := common.GetOperationTimeout(messageType, browserMessage.Payload.OperationName); timeout > 0 {
+							operationName := browserMessage.Payload.OperationName
+							timeoutTimer = time.AfterFunc(timeout, func() {
+								handleQueryTimeout(browserConnection, queryId, operationName, timeout)
+							})
+						}
+					}
+
 					// Identify if the client that requested this subscription expects to receive json-patch
 					// Client append `Patched_` to the query operationName to indicate that it supports
 					jsonPatchSupported := false
@@ -207,6 +341,8 @@ RangeLoop:
 					}
 
 					browserConnection.ActiveSubscriptionsMutex.Lock()
+					// Keep the count of retransmissions still in the channel (e.g. sent again after another reconnection)
+					pendingRetransmissions := browserConnection.ActiveSubscriptions[queryId].PendingRetransmissions
 					browserConnection.ActiveSubscriptions[queryId] = common.GraphQlSubscription{
 						Id:                         queryId,
 						Message:                    fromBrowserMessage,
@@ -218,10 +354,20 @@ RangeLoop:
 						JsonPatchSupported:         jsonPatchSupported,
 						Type:                       messageType,
 						LastReceivedDataChecksum:   lastReceivedDataChecksum,
+						LastReceivedData:           lastReceivedData,
+						TimeoutTimer:               timeoutTimer,
+						CacheKey:                   cacheKey,
+						PendingRetransmissions:     pendingRetransmissions,
+						Held:                       holdOperation,
 					}
 					// hc.BrowserConn.Logger.Tracef("Current queries: %v", browserConnection.ActiveSubscriptions)
 					browserConnection.ActiveSubscriptionsMutex.Unlock()
 
+					if cachedMessage != nil {
+						hc.BrowserConn.Logger.Tracef("sending cached result of %s to browser", browserMessage.Payload.OperationName)
+						browserConnection.FromHasuraToBrowserChannel.SendWait(hc.Context, cachedMessage)
+					}
+
 					// Add Prometheus Metrics
 					common.GqlSubscribeCounter.
 						With(prometheus.Labels{
@@ -239,6 +385,9 @@ RangeLoop:
 				if browserMessage.Type == "complete" {
 					// Remove subscriptions from ActivitiesOverview here once Hasura-Reader will ignore "complete" msg for them
 					browserConnection.ActiveSubscriptionsMutex.Lock()
+					if subscription, exists := browserConnection.ActiveSubscriptions[browserMessage.ID]; exists && subscription.TimeoutTimer != nil {
+						subscription.TimeoutTimer.Stop()
+					}
 					delete(browserConnection.ActiveSubscriptions, browserMessage.ID)
 					// hc.BrowserConn.Logger.Tracef("Current queries: %v", browserConnection.ActiveSubscriptions)
 					browserConnection.ActiveSubscriptionsMutex.Unlock()
@@ -256,15 +405,15 @@ RangeLoop:
 					continue
 				}
 
-				if !hc.BrowserConn.CurrentlyInMeeting && // avoid sending to Hasura subscriptions that user doesn't have permission
-					browserMessage.Type == "subscribe" &&
-					!slices.Contains(config.AllowedSubscriptionsForNotInMeetingUsers, browserMessage.Payload.OperationName) {
-					hc.BrowserConn.Logger.Debugf("Not sending to Hasura %s because the user is not in meeting", browserMessage.Payload.OperationName)
+				if holdOperation { // avoid sending to Hasura operations that user doesn't have permission yet
 					continue
 				} else {
 					// Sending to Hasura
-					hc.BrowserConn.Logger.Tracef("sending to hasura: %s", string(fromBrowserMessage))
-					errWrite := hc.Websocket.Write(hc.Context, websocket.MessageText, fromBrowserMessage)
+					hc.BrowserConn.Logger.Tracef("sending to hasura: %s", common.RedactSessionTokensInJson(string(fromBrowserMessage)))
+					writeStartedAt := time.Now()
+					errWrite := hc.Upstream.Send(hc.Context, fromBrowserMessage)
+					common.ObserveWebsocketWrite(common.WebsocketEndpointHasura, writeStartedAt)
+					common.ObserveWebsocketMessage(common.WebsocketEndpointHasura, "sent", len(fromBrowserMessage))
 					if errWrite != nil {
 						if !errors.Is(errWrite, context.Canceled) {
 							hc.BrowserConn.Logger.Errorf("error on write (we're disconnected from hasura): %v", errWrite)
@@ -298,32 +447,24 @@ RangeLoop:
 //	}
 //}
 
-func calculateQueryDepth(query string) (int, error) {
-	src := source.NewSource(&source.Source{
-		Body: []byte(query),
-		Name: "GraphQL query",
-	})
-	astDoc, err := parser.Parse(parser.ParseParams{
-		Source: src,
-	})
-	if err != nil {
-		return 0, fmt.Errorf("failed to parse query: %v", err)
-	}
+func calculateQueryDepth(astDoc *ast.Document) int {
+	fragments := common.GetFragmentDefinitions(astDoc)
 
 	maxDepth := 0
 	for _, def := range astDoc.Definitions {
 		if op, ok := def.(*ast.OperationDefinition); ok {
-			depth := traverseSelectionSet(op.SelectionSet, 0)
+			depth := traverseSelectionSet(op.SelectionSet, 0, fragments, make(map[string]int))
 			if depth > maxDepth {
 				maxDepth = depth
 			}
 		}
 	}
 
-	return maxDepth, nil
+	return maxDepth
 }
 
-func traverseSelectionSet(selectionSet *ast.SelectionSet, currentDepth int) int {
+// fragmentDepths keeps the depth of each fragment (relative to where it's spread), so each one is traversed once
+func traverseSelectionSet(selectionSet *ast.SelectionSet, currentDepth int, fragments map[string]*ast.FragmentDefinition, fragmentDepths map[string]int) int {
 	if selectionSet == nil {
 		return currentDepth
 	}
@@ -335,12 +476,23 @@ func traverseSelectionSet(selectionSet *ast.SelectionSet, currentDepth int) int
 		var depth int
 		switch sel := selection.(type) {
 		case *ast.Field:
-			depth = traverseSelectionSet(sel.SelectionSet, currentDepth)
+			depth = traverseSelectionSet(sel.SelectionSet, currentDepth, fragments, fragmentDepths)
 		case *ast.InlineFragment:
-			depth = traverseSelectionSet(sel.SelectionSet, currentDepth)
+			depth = traverseSelectionSet(sel.SelectionSet, currentDepth, fragments, fragmentDepths)
 		case *ast.FragmentSpread:
-			// Without a schema, we cannot resolve fragment spreads
-			continue
+			// Resolve the fragment declared in the query (counted like an inline fragment)
+			fragmentDepth, calculated := fragmentDepths[sel.Name.Value]
+			if !calculated {
+				fragment, exists := fragments[sel.Name.Value]
+				if !exists {
+					continue
+				}
+				// Stored before traversing, so a cycle (rejected before) doesn't recurse forever
+				fragmentDepths[sel.Name.Value] = 0
+				fragmentDepth = traverseSelectionSet(fragment.SelectionSet, 0, fragments, fragmentDepths)
+				fragmentDepths[sel.Name.Value] = fragmentDepth
+			}
+			depth = currentDepth + fragmentDepth
 		}
 		if depth > maxDepth {
 			maxDepth = depth
@@ -350,27 +502,45 @@ func traverseSelectionSet(selectionSet *ast.SelectionSet, currentDepth int) int
 	return maxDepth
 }
 
-func sendErrorMessage(browserConnection *common.BrowserConnection, messageId string, errorMessage string) {
-	browserConnection.Logger.Errorf(errorMessage)
-
-	// Error on sending action, return error msg to client
-	browserResponseData := map[string]interface{}{
-		"id":   messageId,
-		"type": "error",
-		"payload": []interface{}{
-			map[string]interface{}{
-				"message": errorMessage,
-			},
-		},
+// handleQueryTimeout is called when Hasura didn't answer a query in time
+// The query is removed from ActiveSubscriptions, so a late response will be dropped by the Hasura reader
+// removeHeldOperation drops an operation that was stored while held by the policy and didn't pass the checks when released
+func removeHeldOperation(browserConnection *common.BrowserConnection, queryId string) {
+	browserConnection.ActiveSubscriptionsMutex.Lock()
+	if subscription, exists := browserConnection.ActiveSubscriptions[queryId]; exists && subscription.Held {
+		delete(browserConnection.ActiveSubscriptions, queryId)
 	}
-	jsonDataError, _ := json.Marshal(browserResponseData)
-	browserConnection.FromHasuraToBrowserChannel.SendWait(browserConnection.Context, jsonDataError)
+	browserConnection.ActiveSubscriptionsMutex.Unlock()
+}
 
-	// Return complete msg to client
-	browserResponseComplete := map[string]interface{}{
-		"id":   messageId,
-		"type": "complete",
+func handleQueryTimeout(browserConnection *common.BrowserConnection, queryId string, operationName string, timeout time.Duration) {
+	browserConnection.ActiveSubscriptionsMutex.Lock()
+	query, queryIdExists := browserConnection.ActiveSubscriptions[queryId]
+	// Query was answered (the Hasura reader cleared the timer) or cancelled by the client meanwhile
+	if !queryIdExists || query.TimeoutTimer == nil {
+		browserConnection.ActiveSubscriptionsMutex.Unlock()
+		return
 	}
-	jsonDataComplete, _ := json.Marshal(browserResponseComplete)
-	browserConnection.FromHasuraToBrowserChannel.SendWait(browserConnection.Context, jsonDataComplete)
+	delete(browserConnection.ActiveSubscriptions, queryId)
+	browserConnection.ActiveSubscriptionsMutex.Unlock()
+
+	common.GqlOperationTimeoutCounter.
+		With(prometheus.Labels{
+			"type":          string(common.Query),
+			"operationName": operationName,
+		}).
+		Inc()
+
+	// Let Hasura know the result is not necessary anymore
+	hasuraCompleteMessage, _ := json.Marshal(map[string]interface{}{
+		"id":   queryId,
+		"type": "complete",
+	})
+	browserConnection.FromBrowserToHasuraChannel.TrySend(hasuraCompleteMessage)
+
+	common.SendErrorMessage(
+		browserConnection,
+		queryId,
+		common.ErrorIdOperationTimeout,
+		fmt.Sprintf("Query %s timed out after %v without response", operationName, timeout))
 }
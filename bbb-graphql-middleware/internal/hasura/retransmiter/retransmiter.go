@@ -1,14 +1,12 @@
 package retransmiter
 
 import (
-	"slices"
-
-	"bbb-graphql-middleware/config"
 	"bbb-graphql-middleware/internal/common"
+	"bbb-graphql-middleware/internal/policy"
 )
 
 func RetransmitSubscriptionStartMessages(hc *common.HasuraConnection) {
-	hc.BrowserConn.ActiveSubscriptionsMutex.RLock()
+	hc.BrowserConn.ActiveSubscriptionsMutex.Lock()
 	subscriptionsToProcess := make(map[string]common.GraphQlSubscription, 0)
 	for queryId, subscription := range hc.BrowserConn.ActiveSubscriptions {
 		// Not retransmitting Mutations
@@ -16,26 +14,43 @@ func RetransmitSubscriptionStartMessages(hc *common.HasuraConnection) {
 			continue
 		}
 
-		// When user left the meeting, Retransmit only Presence Manager subscriptions
-		if !hc.BrowserConn.CurrentlyInMeeting &&
-			!slices.Contains(config.AllowedSubscriptionsForNotInMeetingUsers, subscription.OperationName) {
-			hc.BrowserConn.Logger.Debugf("Skipping retransmit %s because the user is not in meeting", subscription.OperationName)
+		// Retransmit only the subscriptions allowed by the policy (e.g. when user left the meeting, only Presence Manager ones)
+		hc.BrowserConn.RLock()
+		policyDecision := policy.Evaluate(hc.BrowserConn.BBBWebSessionVariables, subscription.Type, subscription.OperationName)
+		hc.BrowserConn.RUnlock()
+		if !policyDecision.Allowed {
+			hc.BrowserConn.Logger.Debugf("Skipping retransmit %s because it's not allowed by the policy rule %s", subscription.OperationName, policyDecision.Rule)
+			continue
+		}
+
+		if subscription.LastSeenOnHasuraConnection == hc.Id {
 			continue
 		}
 
+		// Let the writer know this message is a retransmission (not a new subscribe from the browser)
+		subscription.PendingRetransmissions++
+		hc.BrowserConn.ActiveSubscriptions[queryId] = subscription
 		subscriptionsToProcess[queryId] = subscription
 	}
-	hc.BrowserConn.ActiveSubscriptionsMutex.RUnlock()
+	hc.BrowserConn.ActiveSubscriptionsMutex.Unlock()
+
+	for queryId, subscription := range subscriptionsToProcess {
+		hc.BrowserConn.Logger.Tracef("retransmiting subscription start: %v", common.RedactSessionTokensInJson(string(subscription.Message)))
 
-	for _, subscription := range subscriptionsToProcess {
-		if subscription.LastSeenOnHasuraConnection != hc.Id {
-			hc.BrowserConn.Logger.Tracef("retransmiting subscription start: %v", string(subscription.Message))
+		var sent bool
+		if subscription.Type == common.Streaming && subscription.StreamCursorCurrValue != nil {
+			sent = hc.BrowserConn.FromBrowserToHasuraChannel.SendWait(hc.Context, common.PatchQuerySettingLastCursorValue(subscription))
+		} else {
+			sent = hc.BrowserConn.FromBrowserToHasuraChannel.SendWait(hc.Context, subscription.Message)
+		}
 
-			if subscription.Type == common.Streaming && subscription.StreamCursorCurrValue != nil {
-				hc.BrowserConn.FromBrowserToHasuraChannel.SendWait(hc.Context, common.PatchQuerySettingLastCursorValue(subscription))
-			} else {
-				hc.BrowserConn.FromBrowserToHasuraChannel.SendWait(hc.Context, subscription.Message)
+		if !sent {
+			hc.BrowserConn.ActiveSubscriptionsMutex.Lock()
+			if subscription, exists := hc.BrowserConn.ActiveSubscriptions[queryId]; exists && subscription.PendingRetransmissions > 0 {
+				subscription.PendingRetransmissions--
+				hc.BrowserConn.ActiveSubscriptions[queryId] = subscription
 			}
+			hc.BrowserConn.ActiveSubscriptionsMutex.Unlock()
 		}
 	}
 }
@@ -0,0 +1,237 @@
+package upstream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"gopkg.in/yaml.v3"
+)
+
+// FakeEngineScript describes the results served by the fake engine
+type FakeEngineScript struct {
+	ConnectionError string                         `yaml:"connection_error"` // when set, connection_init is answered with connection_error
+	Operations      map[string]FakeEngineOperation `yaml:"operations"`       // results by operationName
+	Default         *FakeEngineOperation           `yaml:"default"`          // results of operations not present in Operations
+}
+
+type FakeEngineOperation struct {
+	Results  []FakeEngineResult `yaml:"results"`
+	Complete bool               `yaml:"complete"` // complete subscriptions after the last result (queries are always completed)
+}
+
+type FakeEngineResult struct {
+	DelayMs int                      `yaml:"delay_ms"` // time to wait before sending this result
+	Data    map[string]interface{}   `yaml:"data"`     // sent in a `next` message
+	Errors  []map[string]interface{} `yaml:"errors"`   // when set, an `error` message is sent and the operation is finished
+}
+
+func LoadFakeEngineScript(path string) (*FakeEngineScript, error) {
+	var script FakeEngineScript
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := yaml.Unmarshal(data, &script); err != nil {
+		return nil, err
+	}
+
+	return &script, nil
+}
+
+// FakeEngine is an in-process stand-in for Hasura that speaks graphql-transport-ws
+// It serves the results of a script, allowing to run the middleware without the BBB stack
+type FakeEngine struct {
+	script     *FakeEngineScript
+	outgoing   chan []byte
+	closed     chan struct{}
+	closeOnce  sync.Once
+	operations map[string]context.CancelFunc
+	mutex      sync.Mutex
+}
+
+func NewFakeEngine(script *FakeEngineScript) *FakeEngine {
+	if script == nil {
+		script = &FakeEngineScript{}
+	}
+
+	return &FakeEngine{
+		script:     script,
+		outgoing:   make(chan []byte, 100),
+		closed:     make(chan struct{}),
+		operations: make(map[string]context.CancelFunc),
+	}
+}
+
+func (f *FakeEngine) Dial(ctx context.Context, cookies []*http.Cookie) error {
+	return ctx.Err()
+}
+
+func (f *FakeEngine) Send(ctx context.Context, message []byte) error {
+	select {
+	case <-f.closed:
+		return net.ErrClosed
+	default:
+	}
+
+	var clientMessage struct {
+		Type    string `json:"type"`
+		ID      string `json:"id"`
+		Payload struct {
+			OperationName string `json:"operationName"`
+			Query         string `json:"query"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(message, &clientMessage); err != nil {
+		return err
+	}
+
+	switch clientMessage.Type {
+	case "connection_init":
+		if f.script.ConnectionError != "" {
+			f.push(ctx, map[string]interface{}{"type": "connection_error", "payload": f.script.ConnectionError})
+		} else {
+			f.push(ctx, map[string]interface{}{"type": "connection_ack"})
+		}
+	case "ping":
+		f.push(ctx, map[string]interface{}{"type": "pong"})
+	case "subscribe":
+		f.startOperation(clientMessage.ID, clientMessage.Payload.OperationName, clientMessage.Payload.Query)
+	case "complete":
+		f.mutex.Lock()
+		if cancel, exists := f.operations[clientMessage.ID]; exists {
+			cancel()
+			delete(f.operations, clientMessage.ID)
+		}
+		f.mutex.Unlock()
+	}
+
+	return nil
+}
+
+func (f *FakeEngine) Receive(ctx context.Context) (websocket.MessageType, []byte, error) {
+	select {
+	case <-ctx.Done():
+		return 0, nil, ctx.Err()
+	case <-f.closed:
+		return 0, nil, net.ErrClosed
+	case message := <-f.outgoing:
+		return websocket.MessageText, message, nil
+	}
+}
+
+func (f *FakeEngine) Close(code websocket.StatusCode, reason string) error {
+	f.closeOnce.Do(func() {
+		close(f.closed)
+
+		f.mutex.Lock()
+		for _, cancel := range f.operations {
+			cancel()
+		}
+		f.operations = make(map[string]context.CancelFunc)
+		f.mutex.Unlock()
+	})
+
+	return nil
+}
+
+func (f *FakeEngine) startOperation(id string, operationName string, query string) {
+	operationIsQuery, err := isQueryOperation(query)
+	if err != nil {
+		f.push(context.Background(), newFakeErrorMessage(id, err.Error(), "parse-failed"))
+		return
+	}
+
+	operation, exists := f.script.Operations[operationName]
+	if !exists {
+		if f.script.Default == nil {
+			f.push(context.Background(), newFakeErrorMessage(id, "operation "+operationName+" not found in the script", "validation-failed"))
+			return
+		}
+		operation = *f.script.Default
+	}
+
+	operationCtx, operationCancel := context.WithCancel(context.Background())
+	f.mutex.Lock()
+	f.operations[id] = operationCancel
+	f.mutex.Unlock()
+
+	go func() {
+		defer func() {
+			f.mutex.Lock()
+			delete(f.operations, id)
+			f.mutex.Unlock()
+			operationCancel()
+		}()
+
+		for _, result := range operation.Results {
+			select {
+			case <-operationCtx.Done():
+				return
+			case <-time.After(time.Duration(result.DelayMs) * time.Millisecond):
+			}
+
+			if len(result.Errors) > 0 {
+				f.push(operationCtx, map[string]interface{}{"id": id, "type": "error", "payload": result.Errors})
+				return
+			}
+
+			f.push(operationCtx, map[string]interface{}{"id": id, "type": "next", "payload": map[string]interface{}{"data": result.Data}})
+		}
+
+		if operationIsQuery || operation.Complete {
+			f.push(operationCtx, map[string]interface{}{"id": id, "type": "complete"})
+		}
+	}()
+}
+
+func (f *FakeEngine) push(ctx context.Context, message map[string]interface{}) {
+	messageJson, _ := json.Marshal(message)
+
+	select {
+	case <-ctx.Done():
+	case <-f.closed:
+	case f.outgoing <- messageJson:
+	}
+}
+
+func newFakeErrorMessage(id string, message string, code string) map[string]interface{} {
+	return map[string]interface{}{
+		"id":   id,
+		"type": "error",
+		"payload": []interface{}{
+			map[string]interface{}{
+				"message":    message,
+				"extensions": map[string]interface{}{"code": code},
+			},
+		},
+	}
+}
+
+func isQueryOperation(query string) (bool, error) {
+	astDoc, err := parser.Parse(parser.ParseParams{
+		Source: source.NewSource(&source.Source{Body: []byte(query), Name: "GraphQL query"}),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	for _, def := range astDoc.Definitions {
+		if op, ok := def.(*ast.OperationDefinition); ok {
+			return op.Operation == ast.OperationTypeQuery, nil
+		}
+	}
+
+	return false, errors.New("no operation found in the document")
+}
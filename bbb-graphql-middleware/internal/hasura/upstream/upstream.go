@@ -0,0 +1,34 @@
+package upstream
+
+import (
+	"sync"
+
+	"bbb-graphql-middleware/config"
+	"bbb-graphql-middleware/internal/common"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	upstreamType         = config.GetConfig().Hasura.Upstream
+	fakeEngineScriptPath = config.GetConfig().Hasura.FakeEngineScriptPath
+	fakeEngineScript     *FakeEngineScript
+	fakeEngineScriptOnce sync.Once
+)
+
+// New returns the upstream configured in hasura.upstream (websocket or fake)
+func New(hasuraUrl string) common.Upstream {
+	if upstreamType == "fake" {
+		fakeEngineScriptOnce.Do(func() {
+			var err error
+			if fakeEngineScript, err = LoadFakeEngineScript(fakeEngineScriptPath); err != nil {
+				log.Fatalf("Error loading fake engine script %s: %v", fakeEngineScriptPath, err)
+			}
+			log.Warnf("Using fake engine (script %s) instead of Hasura", fakeEngineScriptPath)
+		})
+
+		return NewFakeEngine(fakeEngineScript)
+	}
+
+	return NewHasuraWebsocket(hasuraUrl)
+}
@@ -0,0 +1,87 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+
+	"bbb-graphql-middleware/internal/common"
+
+	"github.com/coder/websocket"
+	"golang.org/x/xerrors"
+)
+
+// HasuraWebsocket connects to a real Hasura using graphql-transport-ws over websockets
+type HasuraWebsocket struct {
+	Url  string
+	conn *websocket.Conn
+}
+
+func NewHasuraWebsocket(hasuraUrl string) *HasuraWebsocket {
+	return &HasuraWebsocket{Url: hasuraUrl}
+}
+
+func (h *HasuraWebsocket) Dial(ctx context.Context, cookies []*http.Cookie) error {
+	// Add sub-protocol
+	var dialOptions websocket.DialOptions
+	dialOptions.Subprotocols = append(dialOptions.Subprotocols, "graphql-transport-ws")
+
+	// Configure compression (permessage-deflate)
+	dialOptions.CompressionMode = common.HasuraWebsocketCompressionMode
+	dialOptions.CompressionThreshold = common.HasuraWebsocketCompressionThreshold
+
+	// Create cookie jar
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return xerrors.Errorf("failed to create cookie jar: %w", err)
+	}
+	parsedURL, err := url.Parse(h.Url)
+	if err != nil {
+		return xerrors.Errorf("failed to parse url: %w", err)
+	}
+	parsedURL.Scheme = "http"
+	jar.SetCookies(parsedURL, cookies)
+	hc := &http.Client{
+		Jar:       jar,
+		Transport: common.GetHasuraTransportForCompressionMetrics(),
+	}
+	dialOptions.HTTPClient = hc
+
+	// Make the connection
+	hasuraWsConn, _, err := websocket.Dial(ctx, h.Url, &dialOptions)
+	if err != nil {
+		return xerrors.Errorf("error connecting to hasura: %v", err)
+	}
+
+	hasuraWsConn.SetReadLimit(math.MaxInt64 - 1)
+	h.conn = hasuraWsConn
+
+	return nil
+}
+
+func (h *HasuraWebsocket) Send(ctx context.Context, message []byte) error {
+	if h.conn == nil {
+		return errors.New("hasura websocket is not connected")
+	}
+
+	return h.conn.Write(ctx, websocket.MessageText, message)
+}
+
+func (h *HasuraWebsocket) Receive(ctx context.Context) (websocket.MessageType, []byte, error) {
+	if h.conn == nil {
+		return 0, nil, errors.New("hasura websocket is not connected")
+	}
+
+	return h.conn.Read(ctx)
+}
+
+func (h *HasuraWebsocket) Close(code websocket.StatusCode, reason string) error {
+	if h.conn == nil {
+		return nil
+	}
+
+	return h.conn.Close(code, reason)
+}
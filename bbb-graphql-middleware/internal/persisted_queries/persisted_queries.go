@@ -0,0 +1,173 @@
+package persisted_queries
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"bbb-graphql-middleware/config"
+	"bbb-graphql-middleware/internal/common"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+// Persisted queries (Apollo APQ extension): the browser can send only the sha256 hash of a query
+// present in the manifest (built from bbb-html5), and in strict mode only those queries are accepted
+
+var (
+	manifestPath  = config.GetConfig().Server.PersistedQueriesManifestPath
+	strictMode    = config.GetConfig().Server.PersistedQueriesStrict
+	queriesByHash = make(map[string]string)
+)
+
+// Manifest generated by @apollo/generate-persisted-query-manifest
+type manifest struct {
+	Format     string `json:"format"`
+	Version    int    `json:"version"`
+	Operations []struct {
+		Id   string `json:"id"`
+		Name string `json:"name"`
+		Type string `json:"type"`
+		Body string `json:"body"`
+	} `json:"operations"`
+}
+
+func init() {
+	if err := loadManifest(); err != nil {
+		log.Fatalf("Error loading persisted queries manifest %s: %v", manifestPath, err)
+	}
+}
+
+// loadManifest reads the manifest of approved operations (at startup)
+func loadManifest() error {
+	if manifestPath == "" {
+		if strictMode {
+			return fmt.Errorf("persisted_queries_strict requires persisted_queries_manifest_path")
+		}
+		return nil
+	}
+
+	data, err := os.ReadFile(filepath.Clean(manifestPath))
+	if err != nil {
+		return err
+	}
+
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+
+	for _, operation := range m.Operations {
+		hash := getQueryHash(operation.Body)
+		if operation.Id != "" && operation.Id != hash {
+			log.Warnf("Persisted query %s has id %s but its sha256 is %s, the sha256 will be used", operation.Name, operation.Id, hash)
+		}
+		queriesByHash[hash] = operation.Body
+	}
+
+	log.Infof("Loaded %d persisted queries from %s (strict mode: %v)", len(queriesByHash), manifestPath, strictMode)
+
+	return nil
+}
+
+func IsEnabled() bool {
+	return len(queriesByHash) > 0 || strictMode
+}
+
+// ResolveBrowserMessage injects the query of a persisted query hash into the `subscribe` message
+// It returns false when the message was rejected (the error was already sent to the browser)
+func ResolveBrowserMessage(browserConnection *common.BrowserConnection, message []byte) ([]byte, bool) {
+	if !IsEnabled() {
+		return message, true
+	}
+
+	var browserMessage common.BrowserSubscribeMessage
+	if err := json.Unmarshal(message, &browserMessage); err != nil {
+		browserConnection.Logger.Errorf("failed to unmarshal message: %v", err)
+		return message, true
+	}
+
+	hash := getPersistedQueryHash(browserMessage)
+	if hash == "" {
+		if browserMessage.Payload.Query == "" || !strictMode {
+			common.GqlPersistedQueryCounter.With(prometheus.Labels{"result": "bypass"}).Inc()
+			return message, true
+		}
+
+		if _, exists := queriesByHash[getQueryHash(browserMessage.Payload.Query)]; !exists {
+			common.GqlPersistedQueryCounter.With(prometheus.Labels{"result": "rejected"}).Inc()
+			common.AddAbuseScore(browserConnection, common.AbuseReasonRejectedQuery)
+			common.SendErrorMessage(browserConnection, browserMessage.ID, common.ErrorIdPermissionDenied,
+				fmt.Sprintf("operation %s is not in the persisted queries manifest", browserMessage.Payload.OperationName))
+			return nil, false
+		}
+
+		common.GqlPersistedQueryCounter.With(prometheus.Labels{"result": "hit"}).Inc()
+		return message, true
+	}
+
+	query, exists := queriesByHash[hash]
+	if !exists {
+		// Without strict mode the browser can resend it with the full query (APQ flow)
+		if browserMessage.Payload.Query != "" && !strictMode && getQueryHash(browserMessage.Payload.Query) == hash {
+			common.GqlPersistedQueryCounter.With(prometheus.Labels{"result": "bypass"}).Inc()
+			return message, true
+		}
+
+		common.GqlPersistedQueryCounter.With(prometheus.Labels{"result": "miss"}).Inc()
+		common.SendErrorMessage(browserConnection, browserMessage.ID, common.ErrorIdPersistedQueryNotFound, "PersistedQueryNotFound")
+		return nil, false
+	}
+	common.GqlPersistedQueryCounter.With(prometheus.Labels{"result": "hit"}).Inc()
+
+	if browserMessage.Payload.Query == query {
+		return message, true
+	}
+
+	// Replace the message with the query of the manifest (Hasura doesn't support APQ)
+	var browserMessageMap map[string]interface{}
+	if err := json.Unmarshal(message, &browserMessageMap); err != nil {
+		browserConnection.Logger.Errorf("failed to unmarshal message: %v", err)
+		return message, true
+	}
+	if payload, ok := browserMessageMap["payload"].(map[string]interface{}); ok {
+		payload["query"] = query
+		if extensions, ok := payload["extensions"].(map[string]interface{}); ok {
+			delete(extensions, "persistedQuery")
+			if len(extensions) == 0 {
+				delete(payload, "extensions")
+			}
+		}
+	}
+
+	newMessage, err := json.Marshal(browserMessageMap)
+	if err != nil {
+		browserConnection.Logger.Errorf("failed to marshal message: %v", err)
+		return message, true
+	}
+
+	return newMessage, true
+}
+
+func getPersistedQueryHash(browserMessage common.BrowserSubscribeMessage) string {
+	persistedQuery, ok := browserMessage.Payload.Extensions["persistedQuery"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+
+	if hash, ok := persistedQuery["sha256Hash"].(string); ok {
+		return strings.ToLower(hash)
+	}
+
+	return ""
+}
+
+func getQueryHash(query string) string {
+	hash := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(hash[:])
+}
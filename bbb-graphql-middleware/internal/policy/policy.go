@@ -0,0 +1,181 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"bbb-graphql-middleware/config"
+	"bbb-graphql-middleware/internal/common"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// Policies of operations by role and other session variables (see config/policy.yml)
+
+const (
+	OnDenyReject = "reject"
+	OnDenyHold   = "hold"
+)
+
+type OperationList struct {
+	Allow []string `yaml:"allow" json:"allow,omitempty"`
+	Deny  []string `yaml:"deny" json:"deny,omitempty"`
+}
+
+type Rule struct {
+	Name          string            `yaml:"name" json:"name"`
+	Match         map[string]string `yaml:"match" json:"match"`
+	Queries       OperationList     `yaml:"queries" json:"queries"`
+	Subscriptions OperationList     `yaml:"subscriptions" json:"subscriptions"`
+	Mutations     OperationList     `yaml:"mutations" json:"mutations"`
+	OnDeny        string            `yaml:"on_deny" json:"on_deny"`
+}
+
+type Policy struct {
+	Source string `yaml:"-" json:"source"`
+	Rules  []Rule `yaml:"rules" json:"rules"`
+}
+
+type Decision struct {
+	Allowed bool
+	Hold    bool   // operation must be kept (not sent to Hasura) until the policy allows it
+	Rule    string // name of the rule that denied the operation
+}
+
+var (
+	policyFilePath = config.GetConfig().Server.OperationPolicyFilePath
+	currentPolicy  Policy
+)
+
+func init() {
+	var err error
+	if currentPolicy, err = loadPolicy(); err != nil {
+		log.Fatalf("Error loading operation policy %s: %v", policyFilePath, err)
+	}
+}
+
+func loadPolicy() (Policy, error) {
+	var policy Policy
+
+	data := config.DefaultPolicy
+	policy.Source = "default"
+	if policyFilePath != "" {
+		var err error
+		if data, err = os.ReadFile(filepath.Clean(policyFilePath)); err != nil {
+			return policy, err
+		}
+		policy.Source = policyFilePath
+	}
+
+	if err := yaml.Unmarshal(data, &policy); err != nil {
+		return policy, err
+	}
+
+	for i := range policy.Rules {
+		if policy.Rules[i].OnDeny == "" {
+			policy.Rules[i].OnDeny = OnDenyReject
+		}
+		if policy.Rules[i].OnDeny != OnDenyReject && policy.Rules[i].OnDeny != OnDenyHold {
+			log.Warnf("Invalid on_deny %s in rule %s of operation policy, `reject` will be used", policy.Rules[i].OnDeny, policy.Rules[i].Name)
+			policy.Rules[i].OnDeny = OnDenyReject
+		}
+	}
+
+	// Lists from config (they apply to everyone)
+	allowedSubscriptions := splitOperationList(config.GetConfig().Server.SubscriptionAllowedList)
+	deniedSubscriptions := splitOperationList(config.GetConfig().Server.SubscriptionsDeniedList)
+	if len(allowedSubscriptions) > 0 || len(deniedSubscriptions) > 0 {
+		policy.Rules = append(policy.Rules, Rule{
+			Name:          "subscriptions_allowed_list/subscriptions_denied_list",
+			Match:         map[string]string{},
+			Subscriptions: OperationList{Allow: allowedSubscriptions, Deny: deniedSubscriptions},
+			OnDeny:        OnDenyReject,
+		})
+	}
+
+	log.Infof("Operation policy loaded from %s with %d rules", policy.Source, len(policy.Rules))
+
+	return policy, nil
+}
+
+// GetEffectivePolicy returns the rules in use (including the ones from config lists)
+func GetEffectivePolicy() Policy {
+	return currentPolicy
+}
+
+// Evaluate checks if the operation is allowed for the session variables
+// The first matching rule that denies the operation decides between rejecting or holding it
+// Mutations are evaluated by action name (root field), as the operationName is chosen by the client
+func Evaluate(sessionVariables map[string]string, queryType common.QueryType, operationName string) Decision {
+	operationName = strings.TrimPrefix(operationName, "Patched_")
+
+	for _, rule := range currentPolicy.Rules {
+		if !rule.matches(sessionVariables) {
+			continue
+		}
+
+		operationList := rule.Subscriptions
+		switch queryType {
+		case common.Query:
+			operationList = rule.Queries
+		case common.Mutation:
+			operationList = rule.Mutations
+		}
+
+		if operationList.permits(operationName) {
+			continue
+		}
+
+		return Decision{
+			Allowed: false,
+			Hold:    rule.OnDeny == OnDenyHold && queryType != common.Mutation, // mutations can't wait
+			Rule:    rule.Name,
+		}
+	}
+
+	return Decision{Allowed: true}
+}
+
+func (rule Rule) matches(sessionVariables map[string]string) bool {
+	for sessionVariable, expectedValue := range rule.Match {
+		value := sessionVariables[strings.ToLower(sessionVariable)]
+		if expectedValue == "*" {
+			if value == "" {
+				return false
+			}
+		} else if value != expectedValue {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (operationList OperationList) permits(operationName string) bool {
+	if containsOperation(operationList.Deny, operationName) {
+		return false
+	}
+
+	if len(operationList.Allow) > 0 && !containsOperation(operationList.Allow, operationName) {
+		return false
+	}
+
+	return true
+}
+
+func containsOperation(list []string, operationName string) bool {
+	return slices.Contains(list, "*") || slices.Contains(list, operationName)
+}
+
+// splitOperationList returns the operations of a comma separated list of the config (without the prefix `Patched_`)
+func splitOperationList(list string) []string {
+	operations := common.SplitConfigList(list)
+	for i := range operations {
+		operations[i] = strings.TrimPrefix(operations[i], "Patched_")
+	}
+
+	return operations
+}
@@ -0,0 +1,70 @@
+package policy
+
+import (
+	"testing"
+
+	_ "bbb-graphql-middleware/config/configtest"
+	"bbb-graphql-middleware/internal/common"
+)
+
+func TestEvaluate(t *testing.T) {
+	testPolicy := Policy{
+		Rules: []Rule{
+			{
+				Name:          "not-in-meeting",
+				Match:         map[string]string{"x-hasura-role": "bbb_client_not_in_meeting"},
+				Queries:       OperationList{Allow: []string{"getUserInfo"}},
+				Subscriptions: OperationList{Allow: []string{"userCurrentSubscription"}},
+				Mutations:     OperationList{Allow: []string{"userSetAway"}},
+				OnDeny:        OnDenyHold,
+			},
+			{
+				Name:      "viewers",
+				Match:     map[string]string{"x-hasura-moderatorinmeeting": ""},
+				Mutations: OperationList{Deny: []string{"meetingEnd"}},
+				OnDeny:    OnDenyReject,
+			},
+			{
+				Name:          "everyone",
+				Match:         map[string]string{"x-hasura-userid": "*"},
+				Subscriptions: OperationList{Deny: []string{"getCursorCoordinatesStream"}},
+				OnDeny:        OnDenyReject,
+			},
+		},
+	}
+
+	previousPolicy := currentPolicy
+	currentPolicy = testPolicy
+	t.Cleanup(func() { currentPolicy = previousPolicy })
+
+	notInMeeting := map[string]string{"x-hasura-role": "bbb_client_not_in_meeting", "x-hasura-userid": "user-1"}
+	viewer := map[string]string{"x-hasura-role": "bbb_client", "x-hasura-userid": "user-1"}
+	moderator := map[string]string{"x-hasura-role": "bbb_client", "x-hasura-userid": "user-1", "x-hasura-moderatorinmeeting": "meeting-1"}
+
+	tests := []struct {
+		name             string
+		sessionVariables map[string]string
+		queryType        common.QueryType
+		operationName    string
+		expected         Decision
+	}{
+		{"allowed query", notInMeeting, common.Query, "getUserInfo", Decision{Allowed: true}},
+		{"held query", notInMeeting, common.Query, "getMeetingEndData", Decision{Hold: true, Rule: "not-in-meeting"}},
+		{"allowed subscription with Patched_ prefix", notInMeeting, common.Subscription, "Patched_userCurrentSubscription", Decision{Allowed: true}},
+		{"held subscription", notInMeeting, common.Subscription, "getChatMessages", Decision{Hold: true, Rule: "not-in-meeting"}},
+		{"mutation is rejected instead of held", notInMeeting, common.Mutation, "chatSendMessage", Decision{Rule: "not-in-meeting"}},
+		{"allowed mutation", notInMeeting, common.Mutation, "userSetAway", Decision{Allowed: true}},
+		{"mutation denied by action name", viewer, common.Mutation, "meetingEnd", Decision{Rule: "viewers"}},
+		{"mutation allowed to moderator", moderator, common.Mutation, "meetingEnd", Decision{Allowed: true}},
+		{"subscription denied to everyone", moderator, common.Subscription, "getCursorCoordinatesStream", Decision{Rule: "everyone"}},
+		{"no rule matches", map[string]string{}, common.Subscription, "getCursorCoordinatesStream", Decision{Allowed: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if decision := Evaluate(tt.sessionVariables, tt.queryType, tt.operationName); decision != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, decision)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package policy
+
+import (
+	"fmt"
+
+	"bbb-graphql-middleware/internal/common"
+)
+
+// ReevaluateActiveSubscriptions checks the operations of the connection against its current session variables
+// It must be called after the session variables change (e.g. user was demoted or left the meeting)
+// Operations rejected by the policy are completed with an error, the held ones are kept (but not retransmitted to Hasura)
+// and the ones allowed now will be sent when the connection with Hasura is restarted
+func ReevaluateActiveSubscriptions(browserConnection *common.BrowserConnection) {
+	browserConnection.RLock()
+	sessionVariables := browserConnection.BBBWebSessionVariables
+	browserConnection.RUnlock()
+
+	rejectedSubscriptions := make(map[string]Decision)
+	browserConnection.ActiveSubscriptionsMutex.Lock()
+	for queryId, subscription := range browserConnection.ActiveSubscriptions {
+		if subscription.Type == common.Mutation {
+			continue
+		}
+
+		decision := Evaluate(sessionVariables, subscription.Type, subscription.OperationName)
+		if decision.Allowed || decision.Hold {
+			continue
+		}
+
+		if subscription.TimeoutTimer != nil {
+			subscription.TimeoutTimer.Stop()
+		}
+		delete(browserConnection.ActiveSubscriptions, queryId)
+		rejectedSubscriptions[queryId] = decision
+		browserConnection.Logger.Infof("Completing %s because it's no longer allowed by the policy rule %s", subscription.OperationName, decision.Rule)
+	}
+	browserConnection.ActiveSubscriptionsMutex.Unlock()
+
+	// Streamings are in both maps, so they are removed from both
+	rejectedStreamings := make([]string, 0)
+	browserConnection.ActiveStreamingsMutex.Lock()
+	for operationName, queryId := range browserConnection.ActiveStreamings {
+		if _, rejected := rejectedSubscriptions[queryId]; rejected {
+			delete(browserConnection.ActiveStreamings, operationName)
+			continue
+		}
+
+		decision := Evaluate(sessionVariables, common.Streaming, operationName)
+		if decision.Allowed || decision.Hold {
+			continue
+		}
+
+		delete(browserConnection.ActiveStreamings, operationName)
+		rejectedSubscriptions[queryId] = decision
+		rejectedStreamings = append(rejectedStreamings, queryId)
+		browserConnection.Logger.Infof("Completing %s because it's no longer allowed by the policy rule %s", operationName, decision.Rule)
+	}
+	browserConnection.ActiveStreamingsMutex.Unlock()
+
+	if len(rejectedStreamings) > 0 {
+		browserConnection.ActiveSubscriptionsMutex.Lock()
+		for _, queryId := range rejectedStreamings {
+			if subscription, exists := browserConnection.ActiveSubscriptions[queryId]; exists && subscription.TimeoutTimer != nil {
+				subscription.TimeoutTimer.Stop()
+			}
+			delete(browserConnection.ActiveSubscriptions, queryId)
+		}
+		browserConnection.ActiveSubscriptionsMutex.Unlock()
+	}
+
+	for queryId, decision := range rejectedSubscriptions {
+		common.SendErrorMessage(browserConnection, queryId, common.ErrorIdPermissionDenied,
+			fmt.Sprintf("Operation is no longer allowed by the policy rule %s", decision.Rule))
+	}
+}
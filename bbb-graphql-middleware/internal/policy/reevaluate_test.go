@@ -0,0 +1,78 @@
+package policy
+
+import (
+	"context"
+	"testing"
+
+	_ "bbb-graphql-middleware/config/configtest"
+	"bbb-graphql-middleware/internal/common"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestReevaluateActiveSubscriptions(t *testing.T) {
+	previousPolicy := currentPolicy
+	currentPolicy = Policy{
+		Rules: []Rule{
+			{
+				Name:          "not-in-meeting",
+				Match:         map[string]string{"x-hasura-role": "bbb_client_not_in_meeting"},
+				Subscriptions: OperationList{Allow: []string{"userCurrentSubscription"}},
+				OnDeny:        OnDenyHold,
+			},
+			{
+				Name:          "no-cursor",
+				Match:         map[string]string{"x-hasura-role": "bbb_client_not_in_meeting"},
+				Subscriptions: OperationList{Deny: []string{"getCursorCoordinatesStream"}},
+				OnDeny:        OnDenyReject,
+			},
+		},
+	}
+	t.Cleanup(func() { currentPolicy = previousPolicy })
+
+	browserConnection := &common.BrowserConnection{
+		BBBWebSessionVariables: map[string]string{"x-hasura-role": "bbb_client_not_in_meeting"},
+		ActiveSubscriptions: map[string]common.GraphQlSubscription{
+			"1": {Id: "1", Type: common.Subscription, OperationName: "userCurrentSubscription"},
+			"2": {Id: "2", Type: common.Subscription, OperationName: "getChatMessages"},
+			"3": {Id: "3", Type: common.Streaming, OperationName: "getCursorCoordinatesStream"},
+			"4": {Id: "4", Type: common.Streaming, OperationName: "getAnnotationsStream"},
+		},
+		ActiveStreamings: map[string]string{
+			"getCursorCoordinatesStream": "3",
+			"getAnnotationsStream":       "4",
+		},
+		Context:                    context.Background(),
+		FromHasuraToBrowserChannel: common.NewSafeChannelByte(10),
+		Logger:                     log.WithField("test", t.Name()),
+	}
+
+	ReevaluateActiveSubscriptions(browserConnection)
+
+	// 1 is allowed and the others are held (the first matching rule that denies decides)
+	for _, queryId := range []string{"1", "2", "3", "4"} {
+		if _, exists := browserConnection.ActiveSubscriptions[queryId]; !exists {
+			t.Errorf("operation %s was removed", queryId)
+		}
+	}
+	if len(browserConnection.ActiveStreamings) != 2 {
+		t.Errorf("held streamings were removed: %v", browserConnection.ActiveStreamings)
+	}
+	if len(browserConnection.FromHasuraToBrowserChannel.ReceiveChannel()) != 0 {
+		t.Errorf("held operations received an error")
+	}
+
+	// Without the hold rule the cursor stream is rejected, and removed from both maps
+	currentPolicy.Rules = currentPolicy.Rules[1:]
+	ReevaluateActiveSubscriptions(browserConnection)
+
+	if _, exists := browserConnection.ActiveSubscriptions["3"]; exists {
+		t.Errorf("rejected streaming is still in ActiveSubscriptions")
+	}
+	if _, exists := browserConnection.ActiveStreamings["getCursorCoordinatesStream"]; exists {
+		t.Errorf("rejected streaming is still in ActiveStreamings")
+	}
+	if _, exists := browserConnection.ActiveStreamings["getAnnotationsStream"]; !exists {
+		t.Errorf("allowed streaming was removed")
+	}
+}
@@ -0,0 +1,224 @@
+package schema_validation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"bbb-graphql-middleware/config"
+	"bbb-graphql-middleware/internal/common"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Schema of Hasura for each role, fetched via introspection (using the admin secret)
+// Operations are validated against it before being sent to Hasura
+
+var (
+	Enabled           = config.GetConfig().Server.SchemaValidationEnabled
+	schemaRoles       = common.SplitConfigList(config.GetConfig().Server.SchemaValidationRoles)
+	hasuraAdminSecret = config.GetConfig().Hasura.AdminSecret
+	hasuraHttpUrl     = getHasuraHttpUrl(config.GetConfig().Hasura.Url)
+)
+
+var schemas = make(map[string]*schema)
+var schemasMutex sync.RWMutex
+
+type typeRef struct {
+	Kind   string   `json:"kind"`
+	Name   string   `json:"name"`
+	OfType *typeRef `json:"ofType"`
+}
+
+type inputValue struct {
+	Name string   `json:"name"`
+	Type *typeRef `json:"type"`
+}
+
+type field struct {
+	Name string       `json:"name"`
+	Args []inputValue `json:"args"`
+	Type *typeRef     `json:"type"`
+}
+
+type fullType struct {
+	Kind        string       `json:"kind"`
+	Name        string       `json:"name"`
+	Fields      []field      `json:"fields"`
+	InputFields []inputValue `json:"inputFields"`
+}
+
+type schema struct {
+	QueryType        string
+	MutationType     string
+	SubscriptionType string
+	Types            map[string]*fullType
+	FetchedAt        time.Time
+}
+
+const introspectionQuery = `query IntrospectionQuery {
+  __schema {
+    queryType { name }
+    mutationType { name }
+    subscriptionType { name }
+    types {
+      kind
+      name
+      fields(includeDeprecated: true) { name args { name type { ...TypeRef } } type { ...TypeRef } }
+      inputFields { name type { ...TypeRef } }
+    }
+  }
+}
+fragment TypeRef on __Type {
+  kind name ofType { kind name ofType { kind name ofType { kind name ofType { kind name } } } }
+}`
+
+func init() {
+	if !Enabled {
+		return
+	}
+
+	// Hasura may not be ready yet, it will retry until the schema of all roles is fetched
+	go func() {
+		for {
+			if errs := RefreshSchemas(context.Background()); len(errs) == 0 {
+				return
+			}
+			time.Sleep(10 * time.Second)
+		}
+	}()
+}
+
+// RefreshSchemas fetches the schema of each role configured, keeping the previous one of the roles that failed
+func RefreshSchemas(ctx context.Context) map[string]error {
+	errs := make(map[string]error)
+	for _, role := range schemaRoles {
+		roleSchema, err := fetchSchema(ctx, role)
+		if err != nil {
+			log.Errorf("Error fetching the schema of role %s: %v", role, err)
+			errs[role] = err
+			continue
+		}
+
+		schemasMutex.Lock()
+		schemas[role] = roleSchema
+		schemasMutex.Unlock()
+
+		log.Infof("Schema of role %s fetched (%d types)", role, len(roleSchema.Types))
+	}
+
+	return errs
+}
+
+// GetSchemasInfo returns the number of types and when the schema of each role was fetched
+func GetSchemasInfo() map[string]interface{} {
+	schemasMutex.RLock()
+	defer schemasMutex.RUnlock()
+
+	info := make(map[string]interface{})
+	for role, roleSchema := range schemas {
+		info[role] = map[string]interface{}{
+			"types":     len(roleSchema.Types),
+			"fetchedAt": roleSchema.FetchedAt,
+		}
+	}
+
+	return info
+}
+
+func getSchema(role string) *schema {
+	schemasMutex.RLock()
+	defer schemasMutex.RUnlock()
+
+	return schemas[role]
+}
+
+func fetchSchema(ctx context.Context, role string) (*schema, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	requestBody, _ := json.Marshal(map[string]interface{}{
+		"operationName": "IntrospectionQuery",
+		"query":         introspectionQuery,
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hasuraHttpUrl, bytes.NewReader(requestBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-hasura-admin-secret", hasuraAdminSecret)
+	req.Header.Set("x-hasura-role", role)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("introspection returned status %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	var introspectionResult struct {
+		Data struct {
+			Schema struct {
+				QueryType        *struct{ Name string } `json:"queryType"`
+				MutationType     *struct{ Name string } `json:"mutationType"`
+				SubscriptionType *struct{ Name string } `json:"subscriptionType"`
+				Types            []*fullType            `json:"types"`
+			} `json:"__schema"`
+		} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(respBody, &introspectionResult); err != nil {
+		return nil, err
+	}
+	if len(introspectionResult.Errors) > 0 {
+		return nil, fmt.Errorf("introspection failed: %s", introspectionResult.Errors[0].Message)
+	}
+
+	introspectionSchema := introspectionResult.Data.Schema
+	roleSchema := &schema{
+		Types:     make(map[string]*fullType),
+		FetchedAt: time.Now(),
+	}
+	if introspectionSchema.QueryType != nil {
+		roleSchema.QueryType = introspectionSchema.QueryType.Name
+	}
+	if introspectionSchema.MutationType != nil {
+		roleSchema.MutationType = introspectionSchema.MutationType.Name
+	}
+	if introspectionSchema.SubscriptionType != nil {
+		roleSchema.SubscriptionType = introspectionSchema.SubscriptionType.Name
+	}
+	for _, schemaType := range introspectionSchema.Types {
+		roleSchema.Types[schemaType.Name] = schemaType
+	}
+
+	if roleSchema.QueryType == "" || len(roleSchema.Types) == 0 {
+		return nil, fmt.Errorf("introspection returned an empty schema")
+	}
+
+	return roleSchema, nil
+}
+
+// getHasuraHttpUrl converts the websocket url of Hasura (ws://host/v1/graphql) into the http one
+func getHasuraHttpUrl(hasuraUrl string) string {
+	if strings.HasPrefix(hasuraUrl, "wss://") {
+		return "https://" + strings.TrimPrefix(hasuraUrl, "wss://")
+	}
+
+	return "http://" + strings.TrimPrefix(hasuraUrl, "ws://")
+}
@@ -0,0 +1,337 @@
+package schema_validation
+
+import (
+	"fmt"
+
+	"bbb-graphql-middleware/internal/common"
+
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/location"
+)
+
+// ValidationError follows the GraphQL spec (message and locations in the query)
+type ValidationError struct {
+	Message   string                    `json:"message"`
+	Locations []location.SourceLocation `json:"locations,omitempty"`
+}
+
+// BuildErrorPayload returns the payload of the `error` message with all the validation errors
+func BuildErrorPayload(validationErrors []ValidationError) []interface{} {
+	payload := make([]interface{}, 0, len(validationErrors))
+	for _, validationError := range validationErrors {
+		payload = append(payload, map[string]interface{}{
+			"message":   validationError.Message,
+			"locations": validationError.Locations,
+			"messageId": common.ErrorIdValidationFailed,
+			"extensions": map[string]interface{}{
+				"code": common.ErrorIdValidationFailed,
+			},
+		})
+	}
+
+	return payload
+}
+
+type validationContext struct {
+	schema             *schema
+	fragments          map[string]*ast.FragmentDefinition
+	variables          map[string]*ast.VariableDefinition
+	variableValues     map[string]interface{}
+	visitedFragments   map[string]bool
+	errors             []ValidationError
+	maxErrorsToCollect int
+}
+
+// ValidateOperation checks the fields, arguments and variables of the operation against the schema of the role
+// It returns nil when there is no schema for the role (validation is skipped)
+func ValidateOperation(role string, operationInfo *common.OperationInfo, variableValues map[string]interface{}) []ValidationError {
+	roleSchema := getSchema(role)
+	if roleSchema == nil || operationInfo == nil {
+		return nil
+	}
+
+	vc := &validationContext{
+		schema:             roleSchema,
+		fragments:          common.GetFragmentDefinitions(operationInfo.Document),
+		variables:          make(map[string]*ast.VariableDefinition),
+		variableValues:     variableValues,
+		visitedFragments:   make(map[string]bool),
+		maxErrorsToCollect: 10,
+	}
+
+	op := operationInfo.Operation
+
+	// Variables must be declared with input types and the required ones must be provided
+	for _, variableDefinition := range op.VariableDefinitions {
+		variableName := variableDefinition.Variable.Name.Value
+		vc.variables[variableName] = variableDefinition
+
+		namedType := getAstNamedType(variableDefinition.Type)
+		schemaType, exists := roleSchema.Types[namedType]
+		if !exists {
+			vc.addError(variableDefinition.Type, "Unknown type \"%s\".", namedType)
+			continue
+		}
+		if schemaType.Kind != "SCALAR" && schemaType.Kind != "ENUM" && schemaType.Kind != "INPUT_OBJECT" {
+			vc.addError(variableDefinition.Type, "Variable \"$%s\" cannot be non-input type \"%s\".", variableName, printAstType(variableDefinition.Type))
+			continue
+		}
+
+		if _, isNonNull := variableDefinition.Type.(*ast.NonNull); isNonNull && variableDefinition.DefaultValue == nil {
+			if value, provided := variableValues[variableName]; !provided || value == nil {
+				vc.addError(variableDefinition, "Variable \"$%s\" of required type \"%s\" was not provided.", variableName, printAstType(variableDefinition.Type))
+			}
+		}
+	}
+
+	rootTypeName := roleSchema.QueryType
+	switch op.Operation {
+	case ast.OperationTypeMutation:
+		rootTypeName = roleSchema.MutationType
+	case ast.OperationTypeSubscription:
+		rootTypeName = roleSchema.SubscriptionType
+	}
+	rootType, exists := roleSchema.Types[rootTypeName]
+	if rootTypeName == "" || !exists {
+		vc.addError(op, "Schema is not configured for %ss.", op.Operation)
+		return vc.errors
+	}
+
+	vc.validateSelectionSet(op.SelectionSet, rootType, true)
+
+	return vc.errors
+}
+
+func (vc *validationContext) addError(node ast.Node, format string, args ...interface{}) {
+	if len(vc.errors) >= vc.maxErrorsToCollect {
+		return
+	}
+
+	validationError := ValidationError{Message: fmt.Sprintf(format, args...)}
+	if node != nil && node.GetLoc() != nil {
+		validationError.Locations = []location.SourceLocation{location.GetLocation(node.GetLoc().Source, node.GetLoc().Start)}
+	}
+	vc.errors = append(vc.errors, validationError)
+}
+
+func (vc *validationContext) validateSelectionSet(selectionSet *ast.SelectionSet, parentType *fullType, isRoot bool) {
+	if selectionSet == nil {
+		return
+	}
+
+	for _, selection := range selectionSet.Selections {
+		switch sel := selection.(type) {
+		case *ast.Field:
+			vc.validateField(sel, parentType, isRoot)
+		case *ast.InlineFragment:
+			fragmentType := parentType
+			if sel.TypeCondition != nil {
+				if fragmentType = vc.getTypeCondition(sel.TypeCondition); fragmentType == nil {
+					continue
+				}
+			}
+			vc.validateSelectionSet(sel.SelectionSet, fragmentType, isRoot)
+		case *ast.FragmentSpread:
+			fragment, exists := vc.fragments[sel.Name.Value]
+			if !exists {
+				vc.addError(sel, "Unknown fragment \"%s\".", sel.Name.Value)
+				continue
+			}
+			if vc.visitedFragments[sel.Name.Value] {
+				continue
+			}
+			vc.visitedFragments[sel.Name.Value] = true
+			if fragmentType := vc.getTypeCondition(fragment.TypeCondition); fragmentType != nil {
+				vc.validateSelectionSet(fragment.SelectionSet, fragmentType, isRoot)
+			}
+		}
+	}
+}
+
+func (vc *validationContext) getTypeCondition(typeCondition *ast.Named) *fullType {
+	schemaType, exists := vc.schema.Types[typeCondition.Name.Value]
+	if !exists {
+		vc.addError(typeCondition, "Unknown type \"%s\".", typeCondition.Name.Value)
+		return nil
+	}
+
+	return schemaType
+}
+
+func (vc *validationContext) validateField(astField *ast.Field, parentType *fullType, isRoot bool) {
+	fieldName := astField.Name.Value
+	if fieldName == "__typename" || (isRoot && (fieldName == "__schema" || fieldName == "__type")) {
+		return
+	}
+
+	var schemaField *field
+	for i := range parentType.Fields {
+		if parentType.Fields[i].Name == fieldName {
+			schemaField = &parentType.Fields[i]
+			break
+		}
+	}
+	if schemaField == nil {
+		vc.addError(astField, "Cannot query field \"%s\" on type \"%s\".", fieldName, parentType.Name)
+		return
+	}
+
+	for _, argument := range astField.Arguments {
+		var schemaArgument *inputValue
+		for i := range schemaField.Args {
+			if schemaField.Args[i].Name == argument.Name.Value {
+				schemaArgument = &schemaField.Args[i]
+				break
+			}
+		}
+		if schemaArgument == nil {
+			vc.addError(argument, "Unknown argument \"%s\" on field \"%s.%s\".", argument.Name.Value, parentType.Name, fieldName)
+			continue
+		}
+
+		vc.validateValue(argument.Value, schemaArgument.Type)
+	}
+
+	fieldType, exists := vc.schema.Types[getNamedType(schemaField.Type)]
+	if !exists {
+		return
+	}
+
+	isLeaf := fieldType.Kind == "SCALAR" || fieldType.Kind == "ENUM"
+	if isLeaf && astField.SelectionSet != nil {
+		vc.addError(astField, "Field \"%s\" must not have a selection since type \"%s\" has no subfields.", fieldName, printTypeRef(schemaField.Type))
+	} else if !isLeaf && astField.SelectionSet == nil {
+		vc.addError(astField, "Field \"%s\" of type \"%s\" must have a selection of subfields.", fieldName, printTypeRef(schemaField.Type))
+	} else if !isLeaf {
+		vc.validateSelectionSet(astField.SelectionSet, fieldType, false)
+	}
+}
+
+// validateValue checks the variables and the fields of input objects used in an argument
+func (vc *validationContext) validateValue(value ast.Value, expectedType *typeRef) {
+	switch v := value.(type) {
+	case *ast.Variable:
+		variableDefinition, exists := vc.variables[v.Name.Value]
+		if !exists {
+			vc.addError(v, "Variable \"$%s\" is not defined.", v.Name.Value)
+			return
+		}
+
+		variableType := astTypeToTypeRef(variableDefinition.Type)
+		if expectedType.Kind == "NON_NULL" && variableType.Kind != "NON_NULL" && variableDefinition.DefaultValue != nil {
+			expectedType = expectedType.OfType
+		}
+		if !isTypeCompatible(variableType, expectedType) {
+			vc.addError(v, "Variable \"$%s\" of type \"%s\" used in position expecting type \"%s\".", v.Name.Value, printAstType(variableDefinition.Type), printTypeRef(expectedType))
+		}
+	case *ast.ListValue:
+		itemType := unwrapNonNull(expectedType)
+		if itemType.Kind == "LIST" {
+			itemType = itemType.OfType
+		}
+		for _, item := range v.Values {
+			vc.validateValue(item, itemType)
+		}
+	case *ast.ObjectValue:
+		inputType, exists := vc.schema.Types[getNamedType(expectedType)]
+		if !exists || inputType.Kind != "INPUT_OBJECT" {
+			return
+		}
+
+		for _, objectField := range v.Fields {
+			var schemaInputField *inputValue
+			for i := range inputType.InputFields {
+				if inputType.InputFields[i].Name == objectField.Name.Value {
+					schemaInputField = &inputType.InputFields[i]
+					break
+				}
+			}
+			if schemaInputField == nil {
+				vc.addError(objectField, "Field \"%s\" is not defined by type \"%s\".", objectField.Name.Value, inputType.Name)
+				continue
+			}
+
+			vc.validateValue(objectField.Value, schemaInputField.Type)
+		}
+	}
+}
+
+func isTypeCompatible(variableType *typeRef, expectedType *typeRef) bool {
+	if expectedType == nil || variableType == nil {
+		return expectedType == variableType
+	}
+
+	if expectedType.Kind == "NON_NULL" {
+		if variableType.Kind != "NON_NULL" {
+			return false
+		}
+		return isTypeCompatible(variableType.OfType, expectedType.OfType)
+	}
+	if variableType.Kind == "NON_NULL" {
+		return isTypeCompatible(variableType.OfType, expectedType)
+	}
+
+	if expectedType.Kind == "LIST" {
+		return variableType.Kind == "LIST" && isTypeCompatible(variableType.OfType, expectedType.OfType)
+	}
+	if variableType.Kind == "LIST" {
+		return false
+	}
+
+	return variableType.Name == expectedType.Name
+}
+
+func unwrapNonNull(t *typeRef) *typeRef {
+	if t != nil && t.Kind == "NON_NULL" {
+		return t.OfType
+	}
+
+	return t
+}
+
+func getNamedType(t *typeRef) string {
+	for t != nil && (t.Kind == "NON_NULL" || t.Kind == "LIST") {
+		t = t.OfType
+	}
+	if t == nil {
+		return ""
+	}
+
+	return t.Name
+}
+
+func printTypeRef(t *typeRef) string {
+	if t == nil {
+		return ""
+	}
+
+	switch t.Kind {
+	case "NON_NULL":
+		return printTypeRef(t.OfType) + "!"
+	case "LIST":
+		return "[" + printTypeRef(t.OfType) + "]"
+	default:
+		return t.Name
+	}
+}
+
+func astTypeToTypeRef(t ast.Type) *typeRef {
+	switch v := t.(type) {
+	case *ast.NonNull:
+		return &typeRef{Kind: "NON_NULL", OfType: astTypeToTypeRef(v.Type)}
+	case *ast.List:
+		return &typeRef{Kind: "LIST", OfType: astTypeToTypeRef(v.Type)}
+	case *ast.Named:
+		return &typeRef{Name: v.Name.Value}
+	default:
+		return nil
+	}
+}
+
+func getAstNamedType(t ast.Type) string {
+	return getNamedType(astTypeToTypeRef(t))
+}
+
+func printAstType(t ast.Type) string {
+	return printTypeRef(astTypeToTypeRef(t))
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 
 	"bbb-graphql-middleware/internal/common"
+	"bbb-graphql-middleware/internal/policy"
 )
 
 func ReadNewStreamingSubscription(
@@ -26,11 +27,23 @@ func ReadNewStreamingSubscription(
 	if browserMessage.Type == "subscribe" && browserMessage.Payload.OperationName == operationName {
 		queryId := browserMessage.ID
 
+		browserConnection.RLock()
+		policyDecision := policy.Evaluate(browserConnection.BBBWebSessionVariables, common.Streaming, operationName)
+		browserConnection.RUnlock()
+		if !policyDecision.Allowed {
+			if !policyDecision.Hold {
+				common.AddAbuseScore(browserConnection, common.AbuseReasonRejectedQuery)
+			}
+			common.SendErrorMessage(browserConnection, queryId, common.ErrorIdPermissionDenied, "Operation "+operationName+" is not allowed by the policy rule "+policyDecision.Rule)
+			return nil
+		}
+
 		browserConnection.ActiveStreamingsMutex.RLock()
 		_, queryIdExists := browserConnection.ActiveStreamings[operationName]
 		browserConnection.ActiveStreamingsMutex.RUnlock()
 		if queryIdExists {
-			sendErrorMessage(browserConnection, queryId, "Only one getCursorCoordinatesStream subscription is allowed")
+			common.AddAbuseScore(browserConnection, common.AbuseReasonRejectedQuery)
+			common.SendErrorMessage(browserConnection, queryId, common.ErrorIdLimitExceeded, "Only one getCursorCoordinatesStream subscription is allowed")
 			return nil
 		}
 
@@ -45,28 +58,3 @@ func ReadNewStreamingSubscription(
 
 	return nil
 }
-
-func sendErrorMessage(browserConnection *common.BrowserConnection, messageId string, errorMessage string) {
-	browserConnection.Logger.Error(errorMessage)
-
-	// Error on sending action, return error msg to client
-	browserResponseData := map[string]any{
-		"id":   messageId,
-		"type": "error",
-		"payload": []any{
-			map[string]any{
-				"message": errorMessage,
-			},
-		},
-	}
-	jsonDataError, _ := json.Marshal(browserResponseData)
-	browserConnection.FromHasuraToBrowserChannel.SendWait(browserConnection.Context, jsonDataError)
-
-	// Return complete msg to client
-	browserResponseComplete := map[string]any{
-		"id":   messageId,
-		"type": "complete",
-	}
-	jsonDataComplete, _ := json.Marshal(browserResponseComplete)
-	browserConnection.FromHasuraToBrowserChannel.SendWait(browserConnection.Context, jsonDataComplete)
-}
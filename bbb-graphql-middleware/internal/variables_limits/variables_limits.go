@@ -0,0 +1,150 @@
+package variables_limits
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"bbb-graphql-middleware/config"
+	"bbb-graphql-middleware/internal/common"
+)
+
+// Limits of the variables of the operations (the query length is checked later, by the writers),
+// avoiding huge or deeply nested variables being queued and sent to Hasura or graphql-actions
+
+var (
+	maxVariablesSize         = config.GetConfig().Server.MaxVariablesSize
+	maxVariablesDepth        = config.GetConfig().Server.MaxVariablesDepth
+	maxVariablesArrayLength  = config.GetConfig().Server.MaxVariablesArrayLength
+	rootFieldVariablesLimits = config.GetConfig().Server.RootFieldVariablesLimits
+)
+
+// CheckBrowserMessage validates the variables of the `subscribe` message, using the limits of its root fields
+// It returns false when the message was rejected (the error was already sent to the browser)
+func CheckBrowserMessage(browserConnection *common.BrowserConnection, message []byte, rootFields []string) bool {
+	var browserMessage struct {
+		ID      string `json:"id"`
+		Payload struct {
+			OperationName string          `json:"operationName"`
+			Variables     json.RawMessage `json:"variables"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(message, &browserMessage); err != nil || len(browserMessage.Payload.Variables) == 0 {
+		return true
+	}
+
+	operationName := browserMessage.Payload.OperationName
+	limits := getLimits(rootFields)
+
+	if limits.MaxSize > 0 && len(browserMessage.Payload.Variables) > limits.MaxSize {
+		common.AddAbuseScore(browserConnection, common.AbuseReasonOversizedPayload)
+		common.SendErrorMessage(browserConnection, browserMessage.ID, common.ErrorIdLimitExceeded,
+			fmt.Sprintf("Variables of %s are not valid with size %d and the max allowed is %d", operationName, len(browserMessage.Payload.Variables), limits.MaxSize))
+		return false
+	}
+
+	if limits.MaxDepth <= 0 && limits.MaxArrayLength <= 0 {
+		return true
+	}
+
+	var variables interface{}
+	if err := json.Unmarshal(browserMessage.Payload.Variables, &variables); err != nil {
+		return true
+	}
+
+	depth, maxArrayLength := measureValue(variables)
+	if limits.MaxDepth > 0 && depth > limits.MaxDepth {
+		common.AddAbuseScore(browserConnection, common.AbuseReasonOversizedPayload)
+		common.SendErrorMessage(browserConnection, browserMessage.ID, common.ErrorIdLimitExceeded,
+			fmt.Sprintf("Variables of %s are not valid with depth %d and the max allowed is %d", operationName, depth, limits.MaxDepth))
+		return false
+	}
+	if limits.MaxArrayLength > 0 && maxArrayLength > limits.MaxArrayLength {
+		common.AddAbuseScore(browserConnection, common.AbuseReasonOversizedPayload)
+		common.SendErrorMessage(browserConnection, browserMessage.ID, common.ErrorIdLimitExceeded,
+			fmt.Sprintf("Variables of %s are not valid with an array of length %d and the max allowed is %d", operationName, maxArrayLength, limits.MaxArrayLength))
+		return false
+	}
+
+	return true
+}
+
+// getLimits returns the global limits overridden by the ones of the root fields
+// The overrides are used only when all the root fields have one (otherwise a field could borrow the limits of another)
+func getLimits(rootFields []string) config.VariablesLimits {
+	globalLimits := config.VariablesLimits{
+		MaxSize:        maxVariablesSize,
+		MaxDepth:       maxVariablesDepth,
+		MaxArrayLength: maxVariablesArrayLength,
+	}
+	if len(rootFields) == 0 {
+		return globalLimits
+	}
+
+	var limits config.VariablesLimits
+	for i, rootField := range rootFields {
+		rootFieldLimits, exists := rootFieldVariablesLimits[rootField]
+		if !exists {
+			return globalLimits
+		}
+
+		rootFieldLimits = config.VariablesLimits{
+			MaxSize:        overrideLimit(globalLimits.MaxSize, rootFieldLimits.MaxSize),
+			MaxDepth:       overrideLimit(globalLimits.MaxDepth, rootFieldLimits.MaxDepth),
+			MaxArrayLength: overrideLimit(globalLimits.MaxArrayLength, rootFieldLimits.MaxArrayLength),
+		}
+		if i == 0 {
+			limits = rootFieldLimits
+			continue
+		}
+		limits.MaxSize = minLimit(limits.MaxSize, rootFieldLimits.MaxSize)
+		limits.MaxDepth = minLimit(limits.MaxDepth, rootFieldLimits.MaxDepth)
+		limits.MaxArrayLength = minLimit(limits.MaxArrayLength, rootFieldLimits.MaxArrayLength)
+	}
+
+	return limits
+}
+
+func overrideLimit(globalLimit int, rootFieldLimit int) int {
+	if rootFieldLimit > 0 {
+		return rootFieldLimit
+	}
+
+	return globalLimit
+}
+
+// minLimit returns the most restrictive limit (0 means no limit)
+func minLimit(a int, b int) int {
+	if a <= 0 {
+		return b
+	}
+	if b <= 0 {
+		return a
+	}
+
+	return min(a, b)
+}
+
+// measureValue returns the nesting depth of objects/arrays (the variables object counts as 1) and the length of the largest array
+func measureValue(value interface{}) (int, int) {
+	depth, maxArrayLength := 0, 0
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, item := range v {
+			itemDepth, itemMaxArrayLength := measureValue(item)
+			depth = max(depth, itemDepth)
+			maxArrayLength = max(maxArrayLength, itemMaxArrayLength)
+		}
+	case []interface{}:
+		maxArrayLength = len(v)
+		for _, item := range v {
+			itemDepth, itemMaxArrayLength := measureValue(item)
+			depth = max(depth, itemDepth)
+			maxArrayLength = max(maxArrayLength, itemMaxArrayLength)
+		}
+	default:
+		return 0, 0
+	}
+
+	return depth + 1, maxArrayLength
+}
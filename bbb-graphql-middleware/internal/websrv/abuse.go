@@ -0,0 +1,54 @@
+package websrv
+
+import (
+	"sync"
+
+	"bbb-graphql-middleware/internal/common"
+
+	"github.com/coder/websocket"
+)
+
+func init() {
+	common.SetAbuseDetectedHandler(DisconnectAbusiveSession)
+}
+
+// DisconnectAbusiveSession closes all the connections of the session (with 4429) and lets akka-apps know,
+// so the moderators can be notified
+func DisconnectAbusiveSession(browserConnection *common.BrowserConnection, score float64, violations map[common.AbuseReason]int) {
+	browserConnection.RLock()
+	sessionToken := browserConnection.SessionToken
+	meetingId := browserConnection.MeetingId
+	userId := browserConnection.UserId
+	browserConnection.RUnlock()
+
+	BrowserConnectionsMutex.RLock()
+	connectionsToProcess := make([]*common.BrowserConnection, 0)
+	for _, bc := range BrowserConnections {
+		bc.RLock()
+		if bc.SessionToken == sessionToken {
+			connectionsToProcess = append(connectionsToProcess, bc)
+		}
+		bc.RUnlock()
+	}
+	BrowserConnectionsMutex.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, bc := range connectionsToProcess {
+		wg.Add(1)
+		go func(bc *common.BrowserConnection) {
+			defer wg.Done()
+			bc.FromBrowserToHasuraChannel.FreezeChannel()
+			disconnectWithError(
+				bc.Websocket,
+				bc.Context,
+				bc.ContextCancelFunc,
+				websocket.StatusCode(4429),
+				common.ErrorIdAbuseDetected,
+				common.GetErrorMessage(common.ErrorIdAbuseDetected),
+				bc.Logger)
+		}(bc)
+	}
+	wg.Wait()
+
+	go SendUserGraphqlAbuseDetectedEvtMsg(meetingId, userId, browserConnection.Id, score, violations)
+}
@@ -0,0 +1,114 @@
+package websrv
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"bbb-graphql-middleware/internal/common"
+	"bbb-graphql-middleware/internal/policy"
+	schemavalidation "bbb-graphql-middleware/internal/schema_validation"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var prometheusHandler = promhttp.Handler()
+
+// MetricsHandler serves the Prometheus metrics (/metrics), checking the origin like the admin endpoints
+func MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	if !common.CheckOrigin(w, r, "/metrics") {
+		return
+	}
+
+	prometheusHandler.ServeHTTP(w, r)
+}
+
+// ConnectionsHandler lists the browser connections of a session, found by the hash of its token (as written in the logs)
+func ConnectionsHandler(w http.ResponseWriter, r *http.Request) {
+	if !common.CheckOrigin(w, r, "/admin/connections") {
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sessionTokenHash := r.URL.Query().Get("sessionTokenHash")
+	if sessionTokenHash == "" {
+		http.Error(w, "Missing 'sessionTokenHash' parameter", http.StatusBadRequest)
+		return
+	}
+
+	BrowserConnectionsMutex.RLock()
+	connectionsToProcess := make([]*common.BrowserConnection, 0, len(BrowserConnections))
+	for _, bc := range BrowserConnections {
+		connectionsToProcess = append(connectionsToProcess, bc)
+	}
+	BrowserConnectionsMutex.RUnlock()
+
+	connections := make([]map[string]interface{}, 0)
+	for _, bc := range connectionsToProcess {
+		bc.RLock()
+		if bc.SessionToken != "" && common.HashSessionToken(bc.SessionToken) == sessionTokenHash {
+			connections = append(connections, map[string]interface{}{
+				"browserConnectionId":    bc.Id,
+				"meetingId":              bc.MeetingId,
+				"userId":                 bc.UserId,
+				"clientSessionUUID":      bc.ClientSessionUUID,
+				"role":                   bc.BBBWebSessionVariables["x-hasura-role"],
+				"lastBrowserMessageTime": bc.LastBrowserMessageTime,
+			})
+		}
+		bc.RUnlock()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(connections)
+}
+
+func PolicyHandler(w http.ResponseWriter, r *http.Request) {
+	if !common.CheckOrigin(w, r, "/admin/policy") {
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(policy.GetEffectivePolicy())
+}
+
+func SchemaRefreshHandler(w http.ResponseWriter, r *http.Request) {
+	if !common.CheckOrigin(w, r, "/admin/schema/refresh") {
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !schemavalidation.Enabled {
+		http.Error(w, "Schema validation is disabled", http.StatusNotFound)
+		return
+	}
+
+	errs := make(map[string]string)
+	for role, err := range schemavalidation.RefreshSchemas(r.Context()) {
+		errs[role] = err.Error()
+	}
+
+	status := http.StatusOK
+	if len(errs) > 0 {
+		status = http.StatusBadGateway
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"schemas": schemavalidation.GetSchemasInfo(),
+		"errors":  errs,
+	})
+}
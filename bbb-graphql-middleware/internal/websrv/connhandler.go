@@ -17,6 +17,7 @@ import (
 	"bbb-graphql-middleware/internal/common"
 	"bbb-graphql-middleware/internal/gql_actions"
 	"bbb-graphql-middleware/internal/hasura"
+	"bbb-graphql-middleware/internal/policy"
 	"bbb-graphql-middleware/internal/websrv/reader"
 	"bbb-graphql-middleware/internal/websrv/writer"
 
@@ -66,12 +67,18 @@ func ConnectionHandler(w http.ResponseWriter, r *http.Request) {
 	var acceptOptions websocket.AcceptOptions
 	acceptOptions.Subprotocols = append(acceptOptions.Subprotocols, "graphql-transport-ws")
 
-	// Add Authorized Cross Origin Url
-	if config.GetConfig().Server.AuthorizedCrossOrigin != "" {
-		acceptOptions.OriginPatterns = append(acceptOptions.OriginPatterns, config.GetConfig().Server.AuthorizedCrossOrigin)
+	// Configure compression (permessage-deflate)
+	acceptOptions.CompressionMode = common.BrowserWebsocketCompressionMode
+	acceptOptions.CompressionThreshold = common.BrowserWebsocketCompressionThreshold
+
+	// Add Authorized Cross Origin Urls
+	if !common.CheckOrigin(w, r, "/graphql") {
+		common.WsConnectionRejectedCounter.With(prometheus.Labels{"reason": "origin not authorized"}).Inc()
+		return
 	}
+	acceptOptions.OriginPatterns = append(acceptOptions.OriginPatterns, common.AuthorizedCrossOrigins...)
 
-	browserWsConn, err := websocket.Accept(w, r, &acceptOptions)
+	browserWsConn, err := websocket.Accept(common.WrapResponseWriterForCompressionMetrics(w), r, &acceptOptions)
 	if err != nil {
 		connectionLogger.Errorf("error: %v", err)
 		http.Error(w, "Closing browser connection, reason: request Origin is not authorized", http.StatusForbidden)
@@ -109,11 +116,16 @@ func ConnectionHandler(w http.ResponseWriter, r *http.Request) {
 		FromBrowserToHasuraRateLimiter:     rate.NewLimiter(rate.Every(time.Minute/time.Duration(cfg.Server.MaxConnectionQueriesPerMinute)), cfg.Server.MaxConnectionQueriesPerMinute),
 		FromBrowserToGqlActionsChannel:     common.NewSafeChannelByte(bufferSize),
 		FromBrowserToGqlActionsRateLimiter: rate.NewLimiter(rate.Every(time.Minute/time.Duration(cfg.Server.MaxConnectionMutationsPerMinute)), cfg.Server.MaxConnectionMutationsPerMinute),
+		MutationRateLimiters:               common.NewMutationRateLimiters(),
 		FromHasuraToBrowserChannel:         common.NewSafeChannelByte(bufferSize),
 		LastBrowserMessageTime:             time.Now(),
 		Logger:                             connectionLogger,
 	}
 
+	if cfg.Server.MaxConnectionQueryCostPerMinute > 0 {
+		thisConnection.QueryCostBudgetLimiter = rate.NewLimiter(rate.Limit(float64(cfg.Server.MaxConnectionQueryCostPerMinute)/60), cfg.Server.MaxConnectionQueryCostPerMinute)
+	}
+
 	BrowserConnectionsMutex.Lock()
 	BrowserConnections[browserConnectionId] = &thisConnection
 	BrowserConnectionsMutex.Unlock()
@@ -266,14 +278,17 @@ func invalidateHasuraConnectionForSessionToken(browserConnection *common.Browser
 		return // If there's no Hasura connection, there's nothing to invalidate.
 	}
 
-	browserConnection.Logger.Debugf("Processing invalidate request for sessionToken %v (hasura connection %v)", sessionToken, hasuraConnection.Id)
+	browserConnection.Logger.Debugf("Processing invalidate request for sessionToken %v (hasura connection %v)", common.RedactSessionToken(sessionToken), hasuraConnection.Id)
 
 	// Stop receiving new messages from the browser.
 	browserConnection.Logger.Debug("freezing channel fromBrowserToHasuraChannel")
 	browserConnection.FromBrowserToHasuraChannel.FreezeChannel()
 
-	// Update variables for Mutations (gql-actions requests)
-	go refreshUserSessionVariables(browserConnection)
+	// Update variables (for Mutations and operation policies) before restarting the Hasura connection,
+	// so the retransmission of subscriptions already considers the new role
+	if err, _ := refreshUserSessionVariables(browserConnection); err == nil {
+		policy.ReevaluateActiveSubscriptions(browserConnection)
+	}
 
 	// Cancel the Hasura connection context to clean up resources.
 	if hasuraConnection != nil && hasuraConnection.ContextCancelFunc != nil {
@@ -307,7 +322,7 @@ func InvalidateSessionTokenBrowserConnections(sessionTokenToInvalidate string, r
 }
 
 func invalidateBrowserConnectionForSessionToken(bc *common.BrowserConnection, sessionToken string, reasonMsgId string, reason string) {
-	bc.Logger.Debugf("Processing disconnection request for sessionToken %v (browser connection %v)", sessionToken, bc.Id)
+	bc.Logger.Debugf("Processing disconnection request for sessionToken %v (browser connection %v)", common.RedactSessionToken(sessionToken), bc.Id)
 
 	// Stop receiving new messages from the browser.
 	bc.Logger.Debug("freezing channel fromBrowserToHasuraChannel")
@@ -375,7 +390,7 @@ func connectionInitHandler(browserConnection *common.BrowserConnection) (error,
 			if !existsSessionToken {
 				return fmt.Errorf("X-Session-Token header missing on init connection"), "param_missing"
 			}
-			browserConnection.Logger = browserConnection.Logger.WithField("sessionToken", sessionToken)
+			browserConnection.Logger = browserConnection.Logger.WithField("sessionToken", common.RedactSessionToken(sessionToken))
 
 			if common.HasReachedMaxUserConnections(sessionToken) {
 				return fmt.Errorf("too many connections"), "too_many_connections"
@@ -431,7 +446,7 @@ func connectionInitHandler(browserConnection *common.BrowserConnection) (error,
 
 			browserConnection.Logger.Trace("Success on check authorization")
 
-			browserConnection.Logger.Debugf("[ConnectionInitHandler] intercepted Session Token %v and Client Session UUID %v", sessionToken, clientSessionUUID)
+			browserConnection.Logger.Debugf("[ConnectionInitHandler] intercepted Session Token %v and Client Session UUID %v", common.RedactSessionToken(sessionToken), clientSessionUUID)
 			browserConnection.Lock()
 			browserConnection.SessionToken = sessionToken
 			browserConnection.ClientSessionUUID = clientSessionUUID
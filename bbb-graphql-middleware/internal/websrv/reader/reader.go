@@ -1,7 +1,6 @@
 package reader
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -9,9 +8,12 @@ import (
 	"time"
 
 	"bbb-graphql-middleware/internal/common"
+	persistedqueries "bbb-graphql-middleware/internal/persisted_queries"
 	streamingserver "bbb-graphql-middleware/internal/streaming_server"
+	variableslimits "bbb-graphql-middleware/internal/variables_limits"
 
 	"github.com/coder/websocket"
+	"github.com/graphql-go/graphql/language/ast"
 )
 
 func BrowserConnectionReader(
@@ -54,13 +56,15 @@ func BrowserConnectionReader(
 			return
 		}
 
-		browserConnection.Logger.Tracef("received from browser: %s", string(message))
+		browserConnection.Logger.Tracef("received from browser: %s", common.RedactSessionTokensInJson(string(message)))
+		common.ObserveWebsocketMessage(common.WebsocketEndpointBrowser, "received", len(message))
 		browserConnection.Lock()
 		browserConnection.LastBrowserMessageTime = time.Now()
 		browserConnection.Unlock()
 
 		if messageType != websocket.MessageText {
 			browserConnection.Logger.Warnf("received non-text message: %v", messageType)
+			common.AddAbuseScore(browserConnection, common.AbuseReasonMalformedMessage)
 			continue
 		}
 
@@ -70,15 +74,41 @@ func BrowserConnectionReader(
 		err = json.Unmarshal(message, &browserMessageType)
 		if err != nil {
 			browserConnection.Logger.Errorf("failed to unmarshal message: %v", err)
+			common.AddAbuseScore(browserConnection, common.AbuseReasonMalformedMessage)
 			continue
 		}
 
 		if browserMessageType.Type == "subscribe" {
-			if bytes.Contains(message, []byte("\"query\":\"mutation")) {
+			var accepted bool
+			if message, accepted = persistedqueries.ResolveBrowserMessage(browserConnection, message); !accepted {
+				continue
+			}
+
+			// Operations that can't be parsed are rejected, as the checks (introspection, depth, cost...) rely on the parsed query
+			var browserMessage common.BrowserSubscribeMessage
+			if err := json.Unmarshal(message, &browserMessage); err != nil {
+				browserConnection.Logger.Errorf("failed to unmarshal message: %v", err)
+				common.AddAbuseScore(browserConnection, common.AbuseReasonMalformedMessage)
+				continue
+			}
+
+			operationInfo, err := common.GetOperationInfo(browserMessage.Payload.Query, browserMessage.Payload.OperationName)
+			if err != nil {
+				browserConnection.Logger.Debugf("Operation %s is not valid: %v", browserMessage.Payload.OperationName, err)
+				common.AddAbuseScore(browserConnection, common.AbuseReasonRejectedQuery)
+				common.SendErrorMessage(browserConnection, browserMessage.ID, common.ErrorIdValidationFailed, common.GetErrorMessage(common.ErrorIdValidationFailed))
+				continue
+			}
+
+			if !variableslimits.CheckBrowserMessage(browserConnection, message, operationInfo.RootFields) {
+				continue
+			}
+
+			if operationInfo.Type == common.Mutation {
 				browserConnection.FromBrowserToGqlActionsChannel.SendWait(browserConnection.Context, message)
 				continue
 			}
-			if bytes.Contains(message, []byte("\"query\":\"subscription getCursorCoordinatesStream")) {
+			if operationInfo.OperationType == ast.OperationTypeSubscription && operationInfo.Name == "getCursorCoordinatesStream" {
 				go streamingserver.ReadNewStreamingSubscription(browserConnection, message)
 				continue
 			}
@@ -3,10 +3,16 @@ package websrv
 import (
 	"net/http"
 
+	"bbb-graphql-middleware/internal/common"
+
 	log "github.com/sirupsen/logrus"
 )
 
 func ReconnectionHandler(w http.ResponseWriter, r *http.Request) {
+	if !common.HandleCors(w, r, "/graphql-reconnection", "GET, OPTIONS") {
+		return
+	}
+
 	if r.Method != http.MethodGet {
 		http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
 		return
@@ -20,7 +26,7 @@ func ReconnectionHandler(w http.ResponseWriter, r *http.Request) {
 
 	reason := r.URL.Query().Get("reason")
 
-	log.Debugf("Reconnection request received for sessionToken: %s, reason: %s", sessionToken, reason)
+	log.Debugf("Reconnection request received for sessionToken: %s, reason: %s", common.RedactSessionToken(sessionToken), reason)
 
 	go InvalidateSessionTokenHasuraConnections(sessionToken)
 }
@@ -79,7 +79,7 @@ func StartRedisListener() {
 		if messageName == "ForceUserGraphqlReconnectionSysMsg" {
 			sessionTokenToInvalidate := receivedMessage.Core.Body["sessionToken"]
 			reason := receivedMessage.Core.Body["reason"]
-			log.Infof("Received reconnection request for sessionToken %v (%v)", sessionTokenToInvalidate, reason)
+			log.Infof("Received reconnection request for sessionToken %v (%v)", common.RedactSessionToken(sessionTokenToInvalidate.(string)), reason)
 
 			go InvalidateSessionTokenHasuraConnections(sessionTokenToInvalidate.(string))
 		}
@@ -88,7 +88,7 @@ func StartRedisListener() {
 			sessionTokenToInvalidate := receivedMessage.Core.Body["sessionToken"]
 			reason := receivedMessage.Core.Body["reason"]
 			reasonMsgId := receivedMessage.Core.Body["reasonMessageId"]
-			log.Infof("Received disconnection request for sessionToken %v (%s - %s)", sessionTokenToInvalidate, reasonMsgId, reason)
+			log.Infof("Received disconnection request for sessionToken %v (%s - %s)", common.RedactSessionToken(sessionTokenToInvalidate.(string)), reasonMsgId, reason)
 
 			// Not being used yet
 			go InvalidateSessionTokenBrowserConnections(sessionTokenToInvalidate.(string), reasonMsgId.(string), reason.(string))
@@ -167,10 +167,10 @@ func sendBbbCoreMsgToRedis(name string, body map[string]interface{}) {
 
 	if log.IsLevelEnabled(log.DebugLevel) {
 		if bodyAsJson, err := json.Marshal(body); err == nil {
-			log.Debugf("Redis message sent %s: %s", name, bodyAsJson)
+			log.Debugf("Redis message sent %s: %s", name, common.RedactSessionTokensInJson(string(bodyAsJson)))
 		}
 	}
-	log.Tracef("JSON message sent to channel %s:\n%s\n", channelName, string(messageJSON))
+	log.Tracef("JSON message sent to channel %s:\n%s\n", channelName, common.RedactSessionTokensInJson(string(messageJSON)))
 }
 
 func SendUserGraphqlReconnectionForcedEvtMsg(sessionToken string) {
@@ -191,6 +191,27 @@ func SendUserGraphqlDisconnectionForcedEvtMsg(sessionToken string) {
 	sendBbbCoreMsgToRedis("UserGraphqlDisconnectionForcedEvtMsg", body)
 }
 
+// SendUserGraphqlAbuseDetectedEvtMsg lets akka-apps know the user was disconnected, so moderators can be notified
+// The sessionToken is not sent, as the event can be read by other components
+func SendUserGraphqlAbuseDetectedEvtMsg(
+	meetingId string,
+	userId string,
+	browserConnectionId string,
+	score float64,
+	violations map[common.AbuseReason]int,
+) {
+	body := map[string]interface{}{
+		"middlewareUID":       common.GetUniqueID(),
+		"meetingId":           meetingId,
+		"userId":              userId,
+		"browserConnectionId": browserConnectionId,
+		"score":               score,
+		"violations":          violations,
+	}
+
+	sendBbbCoreMsgToRedis("UserGraphqlAbuseDetectedEvtMsg", body)
+}
+
 func SendUserGraphqlConnectionEstablishedSysMsg(
 	sessionToken string,
 	clientSessionUUID string,
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"sync"
+	"time"
 
 	"bbb-graphql-middleware/internal/common"
 
@@ -33,8 +34,11 @@ RangeLoop:
 					continue
 				}
 
-				browserConnection.Logger.Tracef("sending to browser: %s", string(toBrowserMessage))
+				browserConnection.Logger.Tracef("sending to browser: %s", common.RedactSessionTokensInJson(string(toBrowserMessage)))
+				writeStartedAt := time.Now()
 				err := browserConnection.Websocket.Write(browserConnection.Context, websocket.MessageText, toBrowserMessage)
+				common.ObserveWebsocketWrite(common.WebsocketEndpointBrowser, writeStartedAt)
+				common.ObserveWebsocketMessage(common.WebsocketEndpointBrowser, "sent", len(toBrowserMessage))
 				if err != nil {
 					browserConnection.Logger.Debugf("Browser is disconnected, skipping writing of ws message: %v", err)
 					return
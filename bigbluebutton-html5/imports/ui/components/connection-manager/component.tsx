@@ -307,6 +307,13 @@ const ConnectionManager: React.FC<ConnectionManagerProps> = ({ children }): Reac
               if (message.type === 'ping') {
                 tsLastPingMessageRef.current = Date.now();
               }
+              if (message.type === 'pong' && message.payload?.pendingMutation) {
+                // the server keeps the mutation until it's able to execute it, the result will come later
+                logger.info({
+                  logCode: 'graphql_mutation_pending',
+                  extraInfo: { messageId: message.payload.pendingMutation },
+                }, 'Mutation is pending until the server is able to execute it');
+              }
               if (message.type === 'error' && message.id === '-1') {
                 // message ID -1 as a signal to terminate the session
                 // it contains a prop message.messageId which can be used to show a proper error to the user
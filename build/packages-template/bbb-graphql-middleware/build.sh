@@ -40,6 +40,10 @@ chmod 644 staging/etc/nginx/sites-available/hasura-loadbalancer.conf
 # Create config file
 cp config/config.yml staging/usr/share/bbb-graphql-middleware/config.yml
 chmod a+r staging/usr/share/bbb-graphql-middleware/config.yml
+cp config/fake-engine.example.yml staging/usr/share/bbb-graphql-middleware/fake-engine.example.yml
+chmod a+r staging/usr/share/bbb-graphql-middleware/fake-engine.example.yml
+cp config/policy.yml staging/usr/share/bbb-graphql-middleware/policy.yml
+chmod a+r staging/usr/share/bbb-graphql-middleware/policy.yml
 
 cp bbb-graphql-middleware.service staging/lib/systemd/system/bbb-graphql-middleware.service
 